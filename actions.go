@@ -0,0 +1,218 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+)
+
+// What the actions do to each file but the keeper, as told by confirm.
+var actionVerbs = map[string]string{
+    "delete":   "remove",
+    "hardlink": "hard-link",
+    "symlink":  "symlink",
+    "reflink":  "reflink",
+}
+
+// For -delete, -hardlink, -symlink and -reflink: in each group, keep the
+// file that keeper picks under policy and remove the others, replace them
+// by hard or symbolic links to it, or make them share its blocks. Every
+// file is compared byte by byte with the keeper first. Archive entries,
+// and for hardlink and reflink, files on another file system than the
+// keeper, are left alone. With dryRun, only print what would be done.
+// Returns the exit code.
+func act(groups []group, action, policy, hardlinks string,
+         dryRun bool) (exitcode int) {
+    w := bufio.NewWriter(os.Stdout)
+    defer w.Flush()
+
+    for _, g := range groups {
+        k := g[keeper(g, policy)]
+        if k.inArchive() {
+            continue
+        }
+        rk, _ := realPath(k.path)
+        for _, p := range g {
+            if p.path == k.path || p.inArchive() ||
+               keptLink(p, k, action, hardlinks) {
+                continue
+            }
+            if err := safeToAct(p, k, rk, action); err != nil {
+                fmt.Fprintf(os.Stderr, "%s: %s; left alone\n", os.Args[0],
+                            err)
+                continue
+            }
+            same, err := sameFile(p.path, k.path)
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+                exitcode = 1
+                continue
+            } else if !same {
+                fmt.Fprintf(os.Stderr, "%s: %s: contents differ from %s;"+
+                            " left alone\n", os.Args[0], p.path, k.path)
+                exitcode = 1
+                continue
+            }
+
+            if dryRun {
+                format := "%s %s to %s\n"
+                if action == "delete" {
+                    format = "%s %s, keeping %s\n"
+                }
+                fmt.Fprintf(w, format, actionVerbs[action],
+                            quotePath(p.path), quotePath(k.path))
+                continue
+            }
+            err = actOn(p.path, k.path, action)
+            if err == errNoReflink {
+                fmt.Fprintf(os.Stderr, "%s: %s: %s\n", os.Args[0], p.path,
+                            err)
+                break   // the rest of g is on the same file system
+            } else if err != nil {
+                fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+                exitcode = 1
+            }
+        }
+    }
+    return
+}
+
+// Returns why action mustn't be done to p, which has the same contents
+// as the keeper k, if so. rk is the realPath of k, or "" if it has none.
+func safeToAct(p, k pathInfo, rk, action string) error {
+    // The same directory entry, reached through a symlink: removing p
+    // would remove k.
+    rp, err := realPath(p.path)
+    if err == nil && rk != "" && rp == rk {
+        return fmt.Errorf("%s: same file as %s", p.path, k.path)
+    }
+    if (action == "hardlink" || action == "reflink") && !sameDevice(p, k) {
+        return fmt.Errorf("%s: not on the same file system as %s", p.path,
+                          k.path)
+    }
+    return nil
+}
+
+// Reports whether p and q are hard links to the same file.
+func sameInode(p, q pathInfo) bool {
+    if p.info == nil || q.info == nil {
+        return false
+    }
+    dp, ip, ok := devIno(p.info)
+    dq, iq, _ := devIno(q.info)
+    return ok && dp == dq && ip == iq
+}
+
+// Do action to the file at path, keeping the one at keep.
+func actOn(path, keep, action string) error {
+    switch action {
+    case "delete":
+        return os.Remove(path)
+    case "hardlink":
+        return replace(path, func(tmp string) error {
+            return os.Link(keep, tmp)
+        })
+    case "symlink":
+        abs, err := filepath.Abs(keep)
+        if err != nil {
+            return err
+        }
+        return replace(path, func(tmp string) error {
+            return os.Symlink(abs, tmp)
+        })
+    }
+    return reflink(path, keep)
+}
+
+// Replace the file at path by what create makes at a temporary path next
+// to it, so that path is never missing.
+func replace(path string, create func(tmp string) error) error {
+    tmp := filepath.Join(filepath.Dir(path),
+                         fmt.Sprintf(".%s.dupes%d", filepath.Base(path),
+                                     os.Getpid()))
+    if err := create(tmp); err != nil {
+        return err
+    }
+    if err := os.Rename(tmp, path); err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    return nil
+}
+
+// Reports whether act leaves p alone as a hard link to the keeper k:
+// hard-linking it would change nothing, and with the -hardlinks policy
+// merge or skip, it's the same copy as k.
+func keptLink(p, k pathInfo, action, hardlinks string) bool {
+    return (action == "hardlink" || hardlinks != "separate") &&
+           sameInode(p, k)
+}
+
+// The number of files act would change, and how many bytes that frees:
+// removing a hard link to the keeper frees nothing, and removing all
+// links to another file frees its size once.
+func actionable(groups []group, action, policy,
+                hardlinks string) (n int, size int64) {
+    for _, g := range groups {
+        k := g[keeper(g, policy)]
+        if k.inArchive() {
+            continue
+        }
+        counted := make(map[fileID]bool)
+        if id, ok := linkedFile(k); ok {
+            counted[id] = true
+        }
+        for _, p := range g {
+            if p.path == k.path || p.inArchive() ||
+               keptLink(p, k, action, hardlinks) {
+                continue
+            }
+            n++
+            if id, ok := linkedFile(p); !ok || !counted[id] {
+                counted[id] = true
+                size += p.size
+            }
+        }
+    }
+    return
+}
+
+// Compare the contents of the files at paths a and b.
+func sameFile(a, b string) (bool, error) {
+    fa, err := os.Open(a)
+    if err != nil {
+        return false, err
+    }
+    defer fa.Close()
+    fb, err := os.Open(b)
+    if err != nil {
+        return false, err
+    }
+    defer fb.Close()
+    return sameContents(fa, fb)
+}
+
+// Compare the contents of a and b from the start.
+func sameContents(a, b io.Reader) (bool, error) {
+    ra := bufio.NewReaderSize(a, 1 << 16)
+    rb := bufio.NewReaderSize(b, 1 << 16)
+    bufa, bufb := make([]byte, 1 << 16), make([]byte, 1 << 16)
+    for {
+        na, erra := io.ReadFull(ra, bufa)
+        nb, errb := io.ReadFull(rb, bufb)
+        if !bytes.Equal(bufa[:na], bufb[:nb]) {
+            return false, nil
+        }
+        switch {
+        case erra == io.EOF || erra == io.ErrUnexpectedEOF:
+            return errb == io.EOF || errb == io.ErrUnexpectedEOF, nil
+        case erra != nil:
+            return false, erra
+        case errb != nil && errb != io.EOF && errb != io.ErrUnexpectedEOF:
+            return false, errb
+        }
+    }
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// A group made in a new directory of x, a hard link hl to it and a copy y,
+// with x kept by -keep shortest.
+func linkedGroup(t *testing.T) group {
+    dir := t.TempDir()
+    x := filepath.Join(dir, "x")
+    if err := os.WriteFile(x, []byte("data\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(dir, "y"), []byte("data\n"),
+                           0644); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Link(x, filepath.Join(dir, "hl")); err != nil {
+        t.Skip(err)
+    }
+    var g group
+    for _, name := range []string{"hl", "x", "y"} {
+        path := filepath.Join(dir, name)
+        info, err := os.Lstat(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        g = append(g, pathInfo{path: path, size: info.Size(), info: info})
+    }
+    if _, _, ok := devIno(g[0].info); !ok {
+        t.Skip("no inode numbers")
+    }
+    return g
+}
+
+func TestRedundantHardlinks(t *testing.T) {
+    groups := []group{linkedGroup(t)}
+    for _, c := range []struct {
+        policy string
+        want   int
+    }{
+        {"separate", 2},
+        {"merge", 1},
+    } {
+        if n := redundant(groups, c.policy); n != c.want {
+            t.Errorf("redundant with %s = %d, want %d", c.policy, n,
+                     c.want)
+        }
+    }
+}
+
+func TestActionableHardlinks(t *testing.T) {
+    groups := []group{linkedGroup(t)}
+    for _, c := range []struct {
+        action, hardlinks string
+        n                 int
+        size              int64
+    }{
+        {"delete", "merge", 1, 5},
+        {"delete", "separate", 2, 5},
+        {"hardlink", "merge", 1, 5},
+        {"hardlink", "separate", 1, 5},
+    } {
+        n, size := actionable(groups, c.action, "shortest", c.hardlinks)
+        if n != c.n || size != c.size {
+            t.Errorf("actionable for %s with %s = %d, %d, want %d, %d",
+                     c.action, c.hardlinks, n, size, c.n, c.size)
+        }
+    }
+}
+
+func TestActHardlinks(t *testing.T) {
+    g := linkedGroup(t)
+    if code := act([]group{g}, "delete", "shortest", "merge",
+                   false); code != 0 {
+        t.Fatalf("act returned %d", code)
+    }
+    for _, p := range g {
+        _, err := os.Lstat(p.path)
+        if removed := os.IsNotExist(err); removed != (p.path == g[2].path) {
+            t.Errorf("%s: removed = %t", p.path, removed)
+        }
+    }
+}
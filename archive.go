@@ -0,0 +1,134 @@
+package main
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+// Separator between an archive's path and the name of an entry inside it,
+// as in "backup.zip//photos/cat.jpg".
+const archiveSep = "//"
+
+// Reports whether path looks like an archive we know how to read.
+func isArchive(path string) bool {
+    return archiveKind(path) != ""
+}
+
+func archiveKind(path string) string {
+    lower := strings.ToLower(path)
+    switch {
+    case strings.HasSuffix(lower, ".zip"):
+        return "zip"
+    case strings.HasSuffix(lower, ".tar"):
+        return "tar"
+    case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+        return "tgz"
+    }
+    return ""
+}
+
+// Hash each regular file inside the archive a that o wants, as it would
+// a file on disk, storing the results in byhash under virtual paths of
+// the form archive//entry. The archive is read through o.limiter.
+func hashArchive(a pathInfo, byhash map[string]group, o *Options) {
+    var err error
+    switch archiveKind(a.path) {
+    case "zip":
+        err = hashZip(a, byhash, o)
+    case "tar", "tgz":
+        err = hashTar(a, byhash, o)
+    }
+    if err != nil {
+        errors <- err
+    }
+}
+
+func hashZip(a pathInfo, byhash map[string]group, o *Options) error {
+    r, err := zip.OpenReader(a.path)
+    if err != nil {
+        return err
+    }
+    defer r.Close()
+
+    for _, f := range r.File {
+        if !f.Mode().IsRegular() {
+            continue
+        }
+        vpath := a.path + archiveSep + f.Name
+        size := int64(f.UncompressedSize64)
+        if !o.wantedPath(vpath) || !o.wantedSize(size) {
+            continue
+        }
+        rc, err := f.Open()
+        if err != nil {
+            errors <- fmt.Errorf("%s: %s", vpath, err)
+            continue
+        }
+        h, n, err := hashReader(o.limiter.reader(rc), size)
+        rc.Close()
+        if err != nil {
+            errors <- fmt.Errorf("%s: %s", vpath, err)
+            continue
+        } else if n != size {
+            errors <- shortRead(vpath, n, size)
+            continue
+        }
+        byhash[h] = append(byhash[h], pathInfo{path: vpath, size: size,
+                                               info: f.FileInfo(), hash: h,
+                                               root: a.root, archive: a.path})
+    }
+    return nil
+}
+
+func hashTar(a pathInfo, byhash map[string]group, o *Options) error {
+    path := a.path
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    r := o.limiter.reader(f)
+    if archiveKind(path) == "tgz" {
+        gz, err := gzip.NewReader(r)
+        if err != nil {
+            return fmt.Errorf("%s: %s", path, err)
+        }
+        defer gz.Close()
+        r = gz
+    }
+
+    tr := tar.NewReader(r)
+    for {
+        hdr, err := tr.Next()
+        if err == io.EOF {
+            return nil
+        } else if err != nil {
+            // A corrupt header means we can't find the next entry.
+            return fmt.Errorf("%s: %s", path, err)
+        }
+        if hdr.Typeflag != tar.TypeReg {
+            continue
+        }
+        vpath := path + archiveSep + hdr.Name
+        if !o.wantedPath(vpath) || !o.wantedSize(hdr.Size) {
+            continue
+        }
+        h, n, err := hashReader(tr, hdr.Size)
+        if err != nil {
+            errors <- fmt.Errorf("%s: %s", vpath, err)
+            continue
+        } else if n != hdr.Size {
+            errors <- shortRead(vpath, n, hdr.Size)
+            continue
+        }
+        byhash[h] = append(byhash[h], pathInfo{path: vpath, size: hdr.Size,
+                                               info: hdr.FileInfo(), hash: h,
+                                               root: a.root, archive: path})
+    }
+}
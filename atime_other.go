@@ -0,0 +1,12 @@
+//go:build !unix && !windows
+
+package main
+
+import (
+    "os"
+    "time"
+)
+
+func atime(info os.FileInfo) (time.Time, bool) {
+    return time.Time{}, false
+}
@@ -0,0 +1,19 @@
+//go:build unix && !(darwin || freebsd || netbsd)
+
+package main
+
+import (
+    "os"
+    "syscall"
+    "time"
+)
+
+// Returns the access time of the file that info describes, if the platform
+// provides it.
+func atime(info os.FileInfo) (time.Time, bool) {
+    st, ok := info.Sys().(*syscall.Stat_t)
+    if !ok {
+        return time.Time{}, false
+    }
+    return time.Unix(st.Atim.Unix()), true
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+    "os"
+    "syscall"
+    "time"
+)
+
+func atime(info os.FileInfo) (time.Time, bool) {
+    d, ok := info.Sys().(*syscall.Win32FileAttributeData)
+    if !ok {
+        return time.Time{}, false
+    }
+    return time.Unix(0, d.LastAccessTime.Nanoseconds()), true
+}
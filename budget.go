@@ -0,0 +1,92 @@
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+// Rough number of bytes a file takes up in the map of hashes, not
+// counting its path: the pathInfo, its share of the map and slices, and
+// the digest.
+const entryBytes = 128
+
+// Rough number of bytes taken up by the os.FileInfo that describes a file,
+// with its syscall data.
+const infoBytes = 256
+
+// Memory accounting for -mem-budget. Once the estimated size of the map
+// of hashes exceeds the limit, the scan goes lean: the os.FileInfo of
+// files that have no duplicates (yet) is dropped, and none is kept for
+// files hashed after that. Files that turn out to have duplicates are
+// stat'ed again when the scan is done; see restat.
+type memBudget struct {
+    limit, used int64
+    lean        bool
+    over        bool    // still over the limit when lean
+}
+
+// Returns nil, which keeps every file's metadata, if limit is zero.
+func newMemBudget(limit int64) *memBudget {
+    if limit == 0 {
+        return nil
+    }
+    return &memBudget{limit: limit}
+}
+
+func footprint(p pathInfo) int64 {
+    n := int64(entryBytes + len(p.path))
+    if p.info != nil {
+        n += infoBytes
+    }
+    return n
+}
+
+// Account for p, which is about to be added to byhash.
+func (b *memBudget) add(p *pathInfo, byhash map[string]group) {
+    if b == nil {
+        return
+    }
+    if b.lean {
+        p.info = nil
+    }
+    b.used += footprint(*p)
+
+    switch {
+    case b.used <= b.limit:
+    case !b.lean:
+        b.lean = true
+        b.used = 0
+        for _, g := range byhash {
+            if len(g) == 1 {
+                g[0].info = nil
+            }
+            for _, q := range g {
+                b.used += footprint(q)
+            }
+        }
+        errors <- fmt.Errorf("memory budget of %d bytes reached;"+
+                             " saving memory on file metadata", b.limit)
+    case !b.over:
+        b.over = true
+        errors <- fmt.Errorf("memory budget of %d bytes exceeded; the scan"+
+                             " goes on, but may run out of memory", b.limit)
+    }
+}
+
+// Fill in the os.FileInfo of files in g that was dropped by a memBudget.
+// Files that can no longer be stat'ed are reported and left out.
+func restat(g group) group {
+    kept := g[:0]
+    for _, p := range g {
+        if p.info == nil {
+            info, err := os.Stat(p.path)
+            if err != nil {
+                errors <- err
+                continue
+            }
+            p.info = info
+        }
+        kept = append(kept, p)
+    }
+    return kept
+}
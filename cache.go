@@ -0,0 +1,131 @@
+package main
+
+import (
+    "encoding/gob"
+    "fmt"
+    "os"
+    "sync"
+    "time"
+)
+
+// An on-disk cache of hashes for -cache, so that a repeat scan needn't
+// read files that haven't changed. A file's entry is used as long as the
+// file has the same size, modification time, device and inode number as
+// when it was hashed, and the hashing options are the same.
+type hashCache struct {
+    mu      sync.Mutex
+    path    string
+    mode    string  // hashing options the entries were made with
+    files   map[string]cacheEntry
+    since   time.Time   // when the cache was loaded
+    changed bool
+}
+
+type cacheEntry struct {
+    Size     int64
+    Mtime    int64  // in nanoseconds since the epoch
+    Dev, Ino uint64
+    Hash     string
+}
+
+// The contents of a cache file.
+type cacheFile struct {
+    Mode  string
+    Files map[string]cacheEntry
+}
+
+// Load the cache at path, for hashing with o. A missing file, or with
+// rebuild set an existing one, gives an empty cache, as do entries made
+// with other hashing options.
+func loadCache(path string, rebuild bool, o *Options) (*hashCache, error) {
+    c := &hashCache{path: path, mode: hashMode(o),
+                    files: make(map[string]cacheEntry), since: time.Now()}
+    if rebuild {
+        c.changed = true
+        return c, nil
+    }
+    f, err := os.Open(path)
+    if os.IsNotExist(err) {
+        return c, nil
+    } else if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    var cf cacheFile
+    if err = gob.NewDecoder(f).Decode(&cf); err != nil {
+        return nil, fmt.Errorf("%s: %s (try -rebuild-cache)", path, err)
+    }
+    if cf.Mode == c.mode && cf.Files != nil {
+        c.files = cf.Files
+    } else {
+        c.changed = true
+    }
+    return c, nil
+}
+
+// Describes the options that affect what hashFile computes.
+func hashMode(o *Options) string {
+    return fmt.Sprintf("sha1 cmd=%q normalize=%t eol=%t,%d skip=%d",
+                       o.HashCmd, o.NormalizeText, o.IgnoreEOL, o.EOLLimit,
+                       o.SkipHeader)
+}
+
+func newCacheEntry(info os.FileInfo, h string) cacheEntry {
+    dev, ino, _ := devIno(info)
+    return cacheEntry{Size: info.Size(), Mtime: info.ModTime().UnixNano(),
+                      Dev: dev, Ino: ino, Hash: h}
+}
+
+// The hash stored for the file at path, which info describes, if it's
+// still valid.
+func (c *hashCache) lookup(path string, info os.FileInfo) (string, bool) {
+    if c == nil {
+        return "", false
+    }
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    e, ok := c.files[path]
+    if !ok || e != newCacheEntry(info, e.Hash) {
+        return "", false
+    }
+    return e.Hash, true
+}
+
+// Store h as the hash of the file at path, which info describes.
+func (c *hashCache) store(path string, info os.FileInfo, h string) {
+    // A file modified just before the cache was loaded could be modified
+    // again without its modification time changing, if the file system's
+    // clock is coarse: don't trust its hash next time.
+    if c == nil || !info.ModTime().Before(c.since.Add(-2 * time.Second)) {
+        return
+    }
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.files[path] = newCacheEntry(info, h)
+    c.changed = true
+}
+
+// Write the cache back to its file, if anything changed, replacing the
+// file only once the new one is complete.
+func (c *hashCache) save() error {
+    if c == nil || !c.changed {
+        return nil
+    }
+    tmp := c.path + ".tmp"
+    f, err := os.Create(tmp)
+    if err != nil {
+        return err
+    }
+    err = gob.NewEncoder(f).Encode(cacheFile{c.mode, c.files})
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err == nil {
+        err = os.Rename(tmp, c.path)
+    }
+    if err != nil {
+        os.Remove(tmp)
+    }
+    return err
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+    "bufio"
+    "crypto/sha1"
+    "fmt"
+    "io"
+    "os"
+)
+
+// Content-defined chunking, to estimate how much a block-level
+// deduplicating file system would save. Files are cut into chunks at
+// positions determined by their contents, using a gear hash (as in
+// FastCDC): since boundaries move along with inserted or deleted data,
+// files that share long stretches of content share chunks.
+const (
+    cdcMin  = 2 << 10       // chunk size bounds
+    cdcMax  = 64 << 10
+    // Cut when these 13 bits of the hash are zero, for ~8KiB chunks. The
+    // high bits depend on the last 64 bytes, the low ones on fewer.
+    cdcMask = (1 << 13 - 1) << 51
+)
+
+var gear [256]uint64
+
+func init() {
+    // Any fixed pseudo-random table will do; this is splitmix64.
+    x := uint64(0x9e3779b97f4a7c15)
+    for i := range gear {
+        x += 0x9e3779b97f4a7c15
+        z := x
+        z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+        z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+        gear[i] = z ^ (z >> 31)
+    }
+}
+
+type cdcStats struct {
+    files, chunks         int64
+    bytes, uniqueBytes    int64
+    seen                  map[[sha1.Size]byte]bool
+}
+
+// Chunk the files pushed on paths and tally how many of the chunks are
+// duplicates of one seen before.
+func cdcScan(produce func(paths chan<- pathInfo) int,
+             o *Options) (stats cdcStats, exitcode int) {
+    stats.seen = make(map[[sha1.Size]byte]bool)
+    paths := make(chan pathInfo, o.Queue)
+    done := make(chan empty)
+
+    go func() {
+        for p := range paths {
+            n, err := stats.addFile(p.path, o.limiter)
+            if err != nil {
+                errors <- err
+            }
+            prog.addHashed(n)
+        }
+        done <- empty{}
+    }()
+    exitcode = produce(paths)
+    <-done
+    return
+}
+
+// Chunk the file at path, read through lim, and add its chunks to s.
+// Returns the number of bytes read.
+func (s *cdcStats) addFile(path string, lim *rateLimiter) (n int64,
+                                                         err error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return
+    }
+    defer f.Close()
+
+    r := bufio.NewReaderSize(lim.reader(f), cdcMax)
+    chunk := make([]byte, 0, cdcMax)
+    var h uint64
+    for {
+        c, err := r.ReadByte()
+        if err == io.EOF {
+            break
+        } else if err != nil {
+            return n, err
+        }
+        n++
+        chunk = append(chunk, c)
+        h = h << 1 + gear[c]
+        if len(chunk) >= cdcMin && h & cdcMask == 0 || len(chunk) == cdcMax {
+            s.addChunk(chunk)
+            chunk, h = chunk[:0], 0
+        }
+    }
+    if len(chunk) > 0 {
+        s.addChunk(chunk)
+    }
+    s.files++
+    return
+}
+
+func (s *cdcStats) addChunk(chunk []byte) {
+    sum := sha1.Sum(chunk)
+    s.chunks++
+    s.bytes += int64(len(chunk))
+    if !s.seen[sum] {
+        s.seen[sum] = true
+        s.uniqueBytes += int64(len(chunk))
+    }
+}
+
+func (s *cdcStats) print() {
+    saved, pct := s.bytes - s.uniqueBytes, 0.
+    if s.bytes > 0 {
+        pct = 100 * float64(saved) / float64(s.bytes)
+    }
+    fmt.Printf("%d files, %d bytes in %d chunks, %d of them unique\n",
+               s.files, s.bytes, s.chunks, len(s.seen))
+    fmt.Printf("block-level deduplication would save about %d bytes"+
+               " (%.1f%%)\n", saved, pct)
+}
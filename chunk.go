@@ -0,0 +1,90 @@
+package main
+
+import (
+    "crypto/sha1"
+    "encoding"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "os"
+)
+
+// Files are hashed in chunks of this size. After each chunk, the state of
+// the hash is saved, so that hashing can resume there after a read error
+// instead of starting over.
+const chunkSize = 64 << 20
+
+// How far hashing a file got: the state of the hash after offset bytes of
+// the file's contents, where offset is a multiple of chunkSize. The final
+// digest is the same as when hashing the file in one go. The first skip
+// bytes of the file aren't hashed at all, and don't count for offset.
+type hashState struct {
+    offset int64
+    state  []byte
+    skip   int64
+}
+
+// Hash size followed by the contents of f after the first st.skip bytes,
+// read through lim, resuming from st, which is updated after every chunk.
+// Returns the number of bytes of f hashed.
+func hashChunks(f *os.File, size int64, st *hashState,
+                lim *rateLimiter) (h string, n int64, err error) {
+    sha := sha1.New()
+    if st.offset == 0 {
+        binary.Write(sha, binary.BigEndian, size)
+        if st.skip > 0 {
+            if _, err = f.Seek(st.skip, io.SeekStart); err != nil {
+                return
+            }
+        }
+    } else {
+        err = sha.(encoding.BinaryUnmarshaler).UnmarshalBinary(st.state)
+        if err != nil {
+            return
+        }
+        if _, err = f.Seek(st.skip + st.offset, io.SeekStart); err != nil {
+            return
+        }
+    }
+
+    r := lim.reader(f)
+    for n = st.offset; ; {
+        var m int64
+        m, err = io.CopyN(sha, r, chunkSize)
+        n += m
+        if err == io.EOF {
+            break
+        } else if err != nil {
+            return
+        }
+        st.offset = n
+        if st.state, err = sha.(encoding.BinaryMarshaler).MarshalBinary();
+           err != nil {
+            return
+        }
+    }
+
+    h, err = string(sha.Sum(nil)), nil
+    return
+}
+
+// Reopen the file at path, which info describes, and resume hashing it
+// from st, unless it has changed in the meantime.
+func resume(path string, info os.FileInfo, st *hashState,
+            lim *rateLimiter) (h string, n int64, err error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return
+    }
+    defer f.Close()
+
+    now, err := f.Stat()
+    if err != nil {
+        return
+    }
+    if now.Size() != info.Size() || !now.ModTime().Equal(info.ModTime()) {
+        err = fmt.Errorf("%s: changed while being hashed", path)
+        return
+    }
+    return hashChunks(f, info.Size() - st.skip, st, lim)
+}
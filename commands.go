@@ -0,0 +1,129 @@
+package main
+
+import (
+    "crypto/sha1"
+    "fmt"
+    "os"
+    "os/exec"
+    "strings"
+    "unicode"
+)
+
+// Split the command line s into words at white space, as a shell would
+// without expanding anything: single quotes keep everything up to the
+// next one as is, and a backslash the next character, except that in
+// double quotes it only escapes \ and ".
+func splitCommand(s string) ([]string, error) {
+    var words []string
+    var word strings.Builder
+    inWord, quote := false, rune(0)
+    rs := []rune(s)
+    for i := 0; i < len(rs); i++ {
+        c := rs[i]
+        switch {
+        case quote == '\'':
+            if c == '\'' {
+                quote = 0
+            } else {
+                word.WriteRune(c)
+            }
+        case quote == '"':
+            switch {
+            case c == '"':
+                quote = 0
+            case c == '\\' && i + 1 < len(rs) &&
+                 (rs[i+1] == '\\' || rs[i+1] == '"'):
+                i++
+                word.WriteRune(rs[i])
+            default:
+                word.WriteRune(c)
+            }
+        case c == '\\':
+            if i + 1 == len(rs) {
+                return nil, fmt.Errorf("%q: trailing backslash", s)
+            }
+            i++
+            word.WriteRune(rs[i])
+            inWord = true
+        case c == '\'' || c == '"':
+            quote, inWord = c, true
+        case unicode.IsSpace(c):
+            if inWord {
+                words = append(words, word.String())
+                word.Reset()
+                inWord = false
+            }
+        default:
+            word.WriteRune(c)
+            inWord = true
+        }
+    }
+    if quote != 0 {
+        return nil, fmt.Errorf("%q: unterminated %c quote", s, quote)
+    }
+    if inWord {
+        words = append(words, word.String())
+    }
+    return words, nil
+}
+
+// Returns cmd with each "{}" argument replaced by path, or with path added
+// at the end if there is none.
+func withPath(cmd []string, path string) []string {
+    args, substituted := make([]string, len(cmd)), false
+    for i, arg := range cmd {
+        if arg == "{}" {
+            arg, substituted = path, true
+        }
+        args[i] = arg
+    }
+    if !substituted {
+        args = append(args, path)
+    }
+    return args
+}
+
+// Run the -hash-cmd command for the file at path, given to it as for
+// withPath, and return the SHA-1 of its output, which then serves as the
+// file's hash. Each hashing worker runs one command at a time, so a scan
+// never has more than Options.Jobs of them running.
+func runHashCmd(cmd []string, path string) (string, error) {
+    args := withPath(cmd, path)
+    out, err := exec.Command(args[0], args[1:]...).Output()
+    if err != nil {
+        if e, ok := err.(*exec.ExitError); ok && len(e.Stderr) > 0 {
+            err = fmt.Errorf("%s (%s)", err,
+                             strings.TrimSpace(string(e.Stderr)))
+        }
+        return "", fmt.Errorf("%s: -hash-cmd: %s", path, err)
+    }
+    sum := sha1.Sum(out)
+    return string(sum[:]), nil
+}
+
+// Write groups to a temporary file in the jsonl format and run the
+// -on-complete command cmd with its path, given as for withPath and in the
+// environment variable DUPES_RESULTS. The file is removed afterwards.
+func runOnComplete(cmd []string, groups []group) error {
+    f, err := os.CreateTemp("", "dupes-*.jsonl")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(f.Name())
+    err = writeJSONL(f, groups, nil, nil, false)
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        return err
+    }
+
+    args := withPath(cmd, f.Name())
+    c := exec.Command(args[0], args[1:]...)
+    c.Stdout, c.Stderr = os.Stdout, os.Stderr
+    c.Env = append(os.Environ(), "DUPES_RESULTS=" + f.Name())
+    if err := c.Run(); err != nil {
+        return fmt.Errorf("-on-complete: %s", err)
+    }
+    return nil
+}
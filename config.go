@@ -0,0 +1,91 @@
+package main
+
+import (
+    "bufio"
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// Implemented by the flag.Value of flags that take no separate value.
+type boolFlag interface {
+    IsBoolFlag() bool
+}
+
+// The flags in args, the command line without the program name, mapped to
+// their values, as fs would parse them: up to "--" or the first argument
+// that isn't a flag. This tells which flags were given on the command line
+// rather than by the config file, and lets -config be found before the
+// command line proper is parsed.
+func givenFlags(fs *flag.FlagSet, args []string) map[string]string {
+    given := make(map[string]string)
+    for i := 0; i < len(args); i++ {
+        a := args[i]
+        if len(a) < 2 || a[0] != '-' || a == "--" {
+            break
+        }
+        a = strings.TrimPrefix(a[1:], "-")
+        name, value, found := strings.Cut(a, "=")
+        if !found {
+            if f := fs.Lookup(name); f == nil || isBoolFlag(f) {
+                value = "true"
+            } else if i + 1 < len(args) {
+                i++
+                value = args[i]
+            } else {
+                break   // flag.Parse will complain
+            }
+        }
+        given[name] = value
+    }
+    return given
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+    b, ok := f.Value.(boolFlag)
+    return ok && b.IsBoolFlag()
+}
+
+// Load flag defaults from the config file named by -config in given, the
+// flags on the command line, or from ~/.dupesrc if that exists. Must be
+// called before flag.Parse, so that flags given on the command line
+// override those from the file.
+func loadConfig(given map[string]string) error {
+    path, explicit := given["config"]
+    if !explicit {
+        home, err := os.UserHomeDir()
+        if err != nil {
+            return nil
+        }
+        path = filepath.Join(home, ".dupesrc")
+    }
+
+    f, err := os.Open(path)
+    if os.IsNotExist(err) && !explicit {
+        return nil
+    } else if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    // Lines have the form "flag = value"; blank lines and lines
+    // starting with # are ignored.
+    s := bufio.NewScanner(f)
+    for lineno := 1; s.Scan(); lineno++ {
+        line := strings.TrimSpace(s.Text())
+        if line == "" || line[0] == '#' {
+            continue
+        }
+        name, value, found := strings.Cut(line, "=")
+        name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+        if !found || name == "config" {
+            return fmt.Errorf("%s:%d: expected flag = value", path, lineno)
+        }
+        if err := flag.Set(name, value); err != nil {
+            return fmt.Errorf("%s:%d: %s", path, lineno, err)
+        }
+    }
+    return s.Err()
+}
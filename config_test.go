@@ -0,0 +1,40 @@
+package main
+
+import (
+    "flag"
+    "reflect"
+    "testing"
+)
+
+func TestGivenFlags(t *testing.T) {
+    fs := flag.NewFlagSet("dupes", flag.ContinueOnError)
+    fs.String("config", "", "")
+    fs.String("exclude", "", "")
+    fs.String("min-size", "", "")
+    fs.Bool("v", false, "")
+
+    for _, c := range []struct {
+        args []string
+        want map[string]string
+    }{
+        {[]string{"-config", "rc", "t"}, map[string]string{"config": "rc"}},
+        {[]string{"-exclude", "*.o", "-config", "rc", "t"},
+         map[string]string{"exclude": "*.o", "config": "rc"}},
+        {[]string{"-min-size", "1", "-config", "/nonexistent", "."},
+         map[string]string{"min-size": "1", "config": "/nonexistent"}},
+        {[]string{"-v", "--config=rc", "-exclude=*.o"},
+         map[string]string{"v": "true", "config": "rc", "exclude": "*.o"}},
+        {[]string{"-v=false", "-config"},
+         map[string]string{"v": "false"}},
+        {[]string{"-unknown", "-config", "rc"},
+         map[string]string{"unknown": "true", "config": "rc"}},
+        {[]string{"t", "-config", "rc"}, map[string]string{}},
+        {[]string{"-v", "--", "-config", "rc"},
+         map[string]string{"v": "true"}},
+        {[]string{"-", "-config", "rc"}, map[string]string{}},
+    } {
+        if got := givenFlags(fs, c.args); !reflect.DeepEqual(got, c.want) {
+            t.Errorf("givenFlags(%q) = %v, want %v", c.args, got, c.want)
+        }
+    }
+}
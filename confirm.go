@@ -0,0 +1,25 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// Ask whether to go ahead with an action, such as "remove", on n files,
+// freeing size bytes, before it changes files on disk. The question is
+// only asked when stdin and stdout are terminals; otherwise, the answer
+// is no, since a script should pass -yes to say it means it.
+func confirm(action string, n int, size int64) bool {
+    if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+        fmt.Fprintf(os.Stderr, "%s: not a terminal; pass -yes to %s"+
+                    " %d files\n", os.Args[0], action, n)
+        return false
+    }
+    fmt.Fprintf(os.Stderr, "This will %s %d files freeing %d bytes."+
+                " Continue? [y/N] ", action, n, size)
+    answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+    answer = strings.ToLower(strings.TrimSpace(answer))
+    return answer == "y" || answer == "yes"
+}
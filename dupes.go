@@ -11,14 +11,23 @@
 package main
 
 import (
+    "bufio"
+    "bytes"
     "crypto/sha1"
     "encoding/binary"
+    "encoding/hex"
     "flag"
     "fmt"
     "io"
+    "io/fs"
     "os"
     "path/filepath"
+    "regexp"
+    "runtime"
+    "sort"
     "strings"
+    "sync"
+    "text/template"
 )
 
 type empty struct{}
@@ -26,80 +35,1072 @@ type empty struct{}
 type pathInfo struct {
     path string
     size int64
+    info os.FileInfo
+    hash string     // raw digest, set once the file has been hashed
+    root string     // root under which the file was found
+    archive string  // for an entry in an archive, the archive's path
+}
+
+// Reports whether p is an entry in an archive, rather than a file that
+// can be removed or linked.
+func (p pathInfo) inArchive() bool {
+    return p.archive != ""
+}
+
+// A group of files found to be duplicates, sorted by path.
+type group []pathInfo
+
+// A hex-encoded hash of the group's contents, which identifies it across runs.
+func (g group) id() string {
+    return hex.EncodeToString([]byte(g[0].hash))
+}
+
+func (g group) paths() []string {
+    paths := make([]string, len(g))
+    for i := range g {
+        paths[i] = g[i].path
+    }
+    return paths
 }
 
 var errors chan error
 
+var prog *progress      // nil unless -progress was given
+
 func main() {
-    var quiet bool
-    var root string
+    var allowCrossUser, byDir, cdc, compareXattr, count, countOnly bool
+    var crossFS, crossRoot, del, detectZero, diff, dryRun, explainGroups bool
+    var fromStdin, hardlink, hashOnly, ignoreLoops, jsonSchema, nameColl bool
+    var ignoreEOL, interact, link, linkReport, normalizeText, print0 bool
+    var probeFirst, quiet, read0, rebuild, reflinks, resolve, sameMode bool
+    var scanArchives, selfTest, showHash, showProgress, skipLocked bool
+    var skipMnt, skipSparse, statsByExt, symlink, times, watchTree, yes bool
+    var baseline, cachePath, config, cpuProfile, exclude, follow, format string
+    var against, groupOrder, maxSize, memProfile, minSize string
+    var include, keep, eolLimit, hashCmd, manifest, maxReadRate string
+    var memBudget, mute, onComplete, salt, script, skipHeader, splitDir string
+    var hardlinks, sqlitePath, tmplText, topBy string
+    var jobs, maxFiles, minCopies, queue, retries, topN int
+    var sampleRate float64
+    excludeSizes := make(sizeSet)
+    var excludeDirs, excludeGlobs, includeGlobs globList
 
+    flag.BoolVar(&allowCrossUser, "allow-cross-user", false,
+                 "let -interactive, -gen-script and -delete and such act on"+
+                 " groups with files of different owners")
+    flag.BoolVar(&byDir, "by-dir", false,
+                 "print a table of redundant files per directory on stderr")
+    flag.StringVar(&cachePath, "cache", "",
+                   "reuse the hashes of unchanged files stored in this file")
+    flag.BoolVar(&cdc, "cdc", false,
+                 "estimate block-level deduplication savings instead")
+    flag.StringVar(&against, "compare-against", "",
+                   "only report files that have a copy in this `dir`")
+    flag.StringVar(&baseline, "compare-with", "",
+                   "only report groups not in this -manifest-out file")
+    flag.BoolVar(&compareXattr, "compare-xattr", false,
+                 "warn about duplicates with different extended attributes")
+    flag.StringVar(&config, "config", "",
+                   "read default flags from this file (default ~/.dupesrc)")
+    flag.BoolVar(&count, "count", false,
+                 "end with the number of groups and redundant files")
+    flag.BoolVar(&countOnly, "count-only", false,
+                 "only hash files and report the throughput, to benchmark")
+    flag.StringVar(&cpuProfile, "cpuprofile", "",
+                   "write a CPU profile of the scan to this file")
+    flag.BoolVar(&crossFS, "cross-fs-only", false,
+                 "only report files found on more than one file system")
+    flag.BoolVar(&crossRoot, "cross-root-only", false,
+                 "only report groups with files under more than one root")
+    flag.BoolVar(&del, "delete", false,
+                 "remove all files of each group but the -keep one")
+    flag.BoolVar(&detectZero, "detect-zero", false,
+                 "don't report groups of files that read as all zeros")
+    flag.BoolVar(&diff, "diff", false,
+                 "only report files found under both of exactly two roots")
+    flag.BoolVar(&dryRun, "dry-run", false,
+                 "with -delete and such, only print what would be done")
+    flag.Var(&excludeGlobs, "exclude",
+             "skip files whose path matches this `glob`, e.g. '*.o'"+
+             " (repeatable)")
+    flag.Var(&excludeDirs, "exclude-dir",
+             "don't walk directories matching this `glob`, e.g. .git"+
+             " (repeatable)")
+    flag.StringVar(&exclude, "exclude-re", "",
+                   "skip files whose path matches this regexp")
+    flag.StringVar(&follow, "follow-symlinks", "none",
+                   "which symlinks to follow: none, all or external-only")
+    flag.StringVar(&format, "format", "text",
+                   "output format: text, null, json, jsonl or csv")
+    flag.Var(excludeSizes, "exclude-size",
+             "skip files of exactly this `size`, e.g. 4k (repeatable)")
+    flag.BoolVar(&explainGroups, "explain", false,
+                 "annotate each group with how it was found to match")
+    flag.BoolVar(&fromStdin, "from-stdin", false,
+                 "read the paths of files to check from stdin")
+    flag.StringVar(&script, "gen-script", "",
+                   "write a script to remove duplicates to this file")
+    flag.StringVar(&groupOrder, "group-order", "path",
+                   "order of paths within groups: "+
+                   strings.Join(groupOrders, ", "))
+    flag.BoolVar(&hardlink, "hardlink", false,
+                 "replace duplicates by hard links to the -keep one")
+    flag.StringVar(&hardlinks, "hardlinks", "merge",
+                   "how to count hard links to one file: "+
+                   strings.Join(hardlinkPolicies, ", "))
+    flag.StringVar(&hashCmd, "hash-cmd", "",
+                   "group files by the output of this command, e.g. 'cmd {}'")
+    flag.BoolVar(&hashOnly, "hash-only", false,
+                 "print the hash and path of every file instead")
+    flag.StringVar(&salt, "hash-salt", "",
+                   "report hashes keyed with this salt, to hide content")
+    flag.BoolVar(&ignoreEOL, "ignore-eol", false,
+                 "treat CRLF and LF as the same in small source files")
+    flag.StringVar(&eolLimit, "ignore-eol-limit", "1M",
+                   "largest `size` of file for -ignore-eol")
+    flag.BoolVar(&ignoreLoops, "ignore-symlink-loops", true,
+                 "only warn about symlinks to directories already walked")
+    flag.Var(&includeGlobs, "include",
+             "only check files whose path matches this `glob` (repeatable)")
+    flag.StringVar(&include, "include-re", "",
+                   "only check files whose path matches this regexp")
+    flag.BoolVar(&interact, "interactive", false,
+                 "ask which files of each group to keep and remove the rest")
+    flag.IntVar(&jobs, "j", runtime.GOMAXPROCS(0),
+                "number of files to hash at a time")
+    flag.BoolVar(&jsonSchema, "json-schema", false,
+                 "print a JSON Schema for -format jsonl output and exit")
+    flag.StringVar(&keep, "keep", "first",
+                   "which file of a group to keep: first, shortest,"+
+                   " oldest or newest")
+    flag.BoolVar(&link, "link", false,
+                 "with -gen-script, hard-link duplicates instead of removing")
+    flag.BoolVar(&linkReport, "link-report", false,
+                 "annotate groups with hard-linking details")
+    flag.IntVar(&maxFiles, "max-files", 0,
+                "stop after this many files (0 means no limit)")
+    flag.StringVar(&manifest, "manifest-out", "",
+                   "write the hashes of the groups found to this file")
+    flag.StringVar(&maxReadRate, "max-read-rate", "",
+                   "read files at no more than this many bytes/s, e.g. 10M")
+    flag.StringVar(&maxSize, "max-size", "",
+                   "skip files larger than this size, e.g. 1G")
+    flag.StringVar(&memBudget, "mem-budget", "",
+                   "save memory once the scan needs about this much, e.g. 2G")
+    flag.StringVar(&memProfile, "memprofile", "",
+                   "write a memory profile after the scan to this file")
+    flag.IntVar(&minCopies, "min-copies", 2,
+                "only report groups of at least this many files")
+    flag.StringVar(&minSize, "min-size", "",
+                   "skip files smaller than this size, e.g. 1k")
+    flag.StringVar(&mute, "mute-error", "",
+                   "don't print error messages matching this regexp")
+    flag.BoolVar(&nameColl, "name-collisions", false,
+                 "report files with the same name but different contents")
+    flag.BoolVar(&normalizeText, "normalize-text", false,
+                 "ignore case and CRLF vs. LF in small text files")
+    flag.StringVar(&onComplete, "on-complete", "",
+                   "run this command with a file of the results,"+
+                   " e.g. 'cmd {}'")
+    flag.BoolVar(&print0, "print0", false,
+                 "terminate paths with NUL and groups with an extra NUL")
+    flag.BoolVar(&showProgress, "progress", false,
+                 "report hashing progress on stderr")
+    flag.BoolVar(&probeFirst, "probe-first-block", false,
+                 "only hash files whose first bytes match another's")
+    flag.IntVar(&queue, "queue", 10,
+                "number of files the walk may run ahead of hashing")
     flag.BoolVar(&quiet, "quiet", false,
                  "no error messages during the tree walk")
+    flag.BoolVar(&read0, "read0", false,
+                 "with -from-stdin, paths are NUL-terminated")
+    flag.BoolVar(&rebuild, "rebuild-cache", false,
+                 "with -cache, ignore the hashes in it and start over")
+    flag.Float64Var(&sampleRate, "sample", 1,
+                    "only check this fraction of files, to estimate"+
+                    " duplication")
+    flag.BoolVar(&sameMode, "require-same-mode", false,
+                 "only group files that also have the same permissions")
+    flag.BoolVar(&reflinks, "reflink", false,
+                 "make duplicates share their blocks on Btrfs, XFS and such")
+    flag.BoolVar(&resolve, "resolve-symlinks-in-output", false,
+                 "report paths with symlinks resolved")
+    flag.IntVar(&retries, "retries", 0,
+                "times to resume hashing a file after a read error")
+    flag.BoolVar(&scanArchives, "scan-archives", false,
+                 "also look for duplicates inside tar and zip files")
+    flag.BoolVar(&selfTest, "self-test", false,
+                 "check that dupes works on a small generated tree and exit")
+    flag.BoolVar(&showHash, "show-hash", false,
+                 "print each group's hash before its paths")
+    flag.StringVar(&skipHeader, "skip-header-bytes", "",
+                   "ignore this many bytes at the start of each file")
+    flag.BoolVar(&skipLocked, "skip-locked", false,
+                 "skip files that other processes have locked")
+    flag.BoolVar(&skipMnt, "skip-mounts", false,
+                 "don't descend into file systems mounted below the root")
+    flag.BoolVar(&skipSparse, "skip-sparse", false,
+                 "skip sparse files, such as disk images")
+    flag.StringVar(&splitDir, "split-dir", "",
+                   "also write each group to its own file in this directory")
+    flag.StringVar(&sqlitePath, "sqlite", "",
+                   "add the results to this SQLite database")
+    flag.BoolVar(&statsByExt, "stats-by-ext", false,
+                 "print a table of redundant files per extension on stderr")
+    flag.BoolVar(&symlink, "symlink", false,
+                 "replace duplicates by symbolic links to the -keep one")
+    flag.StringVar(&tmplText, "template", "",
+                   "print each group with this Go text/template")
+    flag.BoolVar(&times, "times", false,
+                 "with -format json, jsonl or csv, add each file's mtime"+
+                 " and atime")
+    flag.IntVar(&topN, "top", 0,
+                "only report this many of the largest groups (0 means all)")
+    flag.StringVar(&topBy, "top-by", "space",
+                   "rank groups for -top by reclaimable space or count")
+    flag.BoolVar(&watchTree, "watch", false,
+                 "after the scan, report new duplicates as files change")
+    flag.BoolVar(&yes, "yes", false,
+                 "with -delete and such, don't ask for confirmation")
+    given := givenFlags(flag.CommandLine, os.Args[1:])
+    if err := loadConfig(given); err != nil {
+        fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+        os.Exit(3)
+    }
     flag.Parse()
+    // Modes that report no groups have nothing to apply -hardlinks to,
+    // and -cdc, -count-only and -watch can't use -cache, but they may have
+    // been set for the others in the config file.
+    _, hardlinksSet := given["hardlinks"]
+    _, cacheSet := given["cache"]
+    if cdc || countOnly || watchTree {
+        cachePath = ""
+    }
 
-    switch flag.NArg() {
-    case 0:
-        root = "."
-    case 1:
-        root = flag.Arg(0)
-    default:
-        fmt.Fprintf(os.Stderr, "usage: %s [flags] [root]\n", os.Args[0])
+    roots := flag.Args()
+    switch {
+    case (selfTest || fromStdin || jsonSchema) && len(roots) > 0:
+        usage()
+    case !fromStdin && len(roots) == 0:
+        roots = []string{"."}
+    }
+    if jsonSchema {
+        if err := writeSchema(os.Stdout); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
+    // -format null is another name for -print0.
+    if format == "null" {
+        format, print0 = "text", true
+    }
+    whole := format == "json" || format == "csv"    // not one group at a time
+    action, actions := "", 0    // at most one of these may be given
+    for name, on := range map[string]bool{"delete": del,
+                                          "hardlink": hardlink,
+                                          "symlink": symlink,
+                                          "reflink": reflinks} {
+        if on {
+            action = name
+            actions++
+        }
+    }
+    if read0 && !fromStdin || crossRoot && fromStdin || link && script == "" ||
+       (yes || dryRun) && action == "" || action != "" && interact ||
+       rebuild && cachePath == "" && !cacheSet ||
+       hardlinksSet && (cdc || countOnly || hashOnly || nameColl) ||
+       against != "" && (fromStdin || diff || crossRoot || nameColl ||
+                         watchTree || cdc || countOnly || hashOnly ||
+                         interact || action != "" || script != "") ||
+       actions > 1 ||
+       times && (format == "text" || watchTree || nameColl) ||
+       whole && (watchTree || nameColl) || format == "csv" && count ||
+       format == "csv" && explainGroups ||
+       nameColl && (cdc || countOnly || hashOnly || watchTree || interact ||
+                    action != "" || script != "" || sqlitePath != "" ||
+                    splitDir != "" || tmplText != "" || diff || crossRoot ||
+                    crossFS || print0 || linkReport || explainGroups ||
+                    count || salt != "") ||
+       diff && len(roots) != 2 ||
+       explainGroups && (print0 || tmplText != "") ||
+       tmplText != "" && (linkReport || print0 || showHash) ||
+       print0 && (count || linkReport || showHash) ||
+       format != "text" && (linkReport || print0 || showHash ||
+                            tmplText != "") ||
+       interact && (format != "text" || print0 || script != "") ||
+       (cdc || countOnly || hashOnly) && (interact || action != "" ||
+                                          script != "" || selfTest ||
+                                          sqlitePath != "" || diff ||
+                                          crossRoot || crossFS ||
+                                          format != "text" ||
+                                          tmplText != "" || salt != "") ||
+       cdc && hashOnly || countOnly && (cdc || hashOnly) ||
+       watchTree && (fromStdin || cdc || countOnly || hashOnly ||
+                     interact || action != "" || script != "" ||
+                     sqlitePath != "" || splitDir != "" ||
+                     onComplete != "" || diff || crossRoot || crossFS ||
+                     topN > 0) ||
+       hashCmd != "" && (cdc || scanArchives || normalizeText || ignoreEOL ||
+                         probeFirst) ||
+       skipHeader != "" && (hashCmd != "" || normalizeText || ignoreEOL ||
+                            cdc || scanArchives) ||
+       (baseline != "" || manifest != "" || compareXattr) &&
+       (cdc || countOnly || hashOnly || watchTree) ||
+       watchTree && (cpuProfile != "" || memProfile != "") ||
+       cacheSet && (cdc || countOnly || watchTree) {
+        usage()
+    }
+    if watchTree && !canWatch {
+        fmt.Fprintf(os.Stderr, "%s: -watch is only supported on Linux\n",
+                    os.Args[0])
+        os.Exit(3)
+    }
+    if sqlitePath != "" && !haveSQLite {
+        fmt.Fprintf(os.Stderr, "%s: -sqlite: this dupes was built without"+
+                    " SQLite support (build with -tags sqlite)\n", os.Args[0])
         os.Exit(3)
     }
+    if !contains(followPolicies, follow) {
+        fmt.Fprintf(os.Stderr, "%s: unknown -follow-symlinks policy %q\n",
+                    os.Args[0], follow)
+        os.Exit(3)
+    }
+    if !contains(hardlinkPolicies, hardlinks) {
+        fmt.Fprintf(os.Stderr, "%s: unknown -hardlinks policy %q\n",
+                    os.Args[0], hardlinks)
+        os.Exit(3)
+    }
+    if !contains([]string{"text", "json", "jsonl", "csv"}, format) {
+        fmt.Fprintf(os.Stderr, "%s: unknown -format %q\n", os.Args[0], format)
+        os.Exit(3)
+    }
+    if sampleRate <= 0 || sampleRate > 1 {
+        fmt.Fprintf(os.Stderr, "%s: -sample must be in (0, 1]\n", os.Args[0])
+        os.Exit(3)
+    }
+    var budget int64
+    if memBudget != "" {
+        var err error
+        if budget, err = parseSize(memBudget); err != nil || budget <= 0 {
+            fmt.Fprintf(os.Stderr, "%s: invalid -mem-budget %q\n",
+                        os.Args[0], memBudget)
+            os.Exit(3)
+        }
+    }
+    eolMax, eolErr := parseSize(eolLimit)
+    if eolErr != nil {
+        fmt.Fprintf(os.Stderr, "%s: invalid -ignore-eol-limit %q\n",
+                    os.Args[0], eolLimit)
+        os.Exit(3)
+    }
+    var header int64
+    if skipHeader != "" {
+        var err error
+        if header, err = parseSize(skipHeader); err != nil || header < 0 {
+            fmt.Fprintf(os.Stderr, "%s: invalid -skip-header-bytes %q\n",
+                        os.Args[0], skipHeader)
+            os.Exit(3)
+        }
+    }
+    var minBytes, maxBytes int64
+    if minSize != "" {
+        var err error
+        if minBytes, err = parseSize(minSize); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: invalid -min-size %q\n",
+                        os.Args[0], minSize)
+            os.Exit(3)
+        }
+    }
+    if maxSize != "" {
+        var err error
+        if maxBytes, err = parseSize(maxSize); err != nil || maxBytes == 0 {
+            fmt.Fprintf(os.Stderr, "%s: invalid -max-size %q\n",
+                        os.Args[0], maxSize)
+            os.Exit(3)
+        }
+        if maxBytes < minBytes {
+            fmt.Fprintf(os.Stderr, "%s: -min-size is larger than -max-size\n",
+                        os.Args[0])
+            os.Exit(3)
+        }
+    }
+    var readRate int64
+    if maxReadRate != "" {
+        var err error
+        readRate, err = parseSize(maxReadRate)
+        if err != nil || readRate <= 0 {
+            fmt.Fprintf(os.Stderr, "%s: invalid -max-read-rate %q\n",
+                        os.Args[0], maxReadRate)
+            os.Exit(3)
+        }
+    }
+    if minCopies < 2 {
+        fmt.Fprintf(os.Stderr, "%s: -min-copies must be at least 2\n",
+                    os.Args[0])
+        os.Exit(3)
+    }
+    if jobs < 1 {
+        fmt.Fprintf(os.Stderr, "%s: -j must be at least 1\n", os.Args[0])
+        os.Exit(3)
+    }
+    if retries < 0 {
+        fmt.Fprintf(os.Stderr, "%s: -retries must not be negative\n",
+                    os.Args[0])
+        os.Exit(3)
+    }
+    if queue < 0 {
+        fmt.Fprintf(os.Stderr, "%s: -queue must not be negative\n", os.Args[0])
+        os.Exit(3)
+    }
+    if topN < 0 || topBy != "space" && topBy != "count" {
+        fmt.Fprintf(os.Stderr, "%s: -top must not be negative and -top-by"+
+                    " must be space or count\n", os.Args[0])
+        os.Exit(3)
+    }
+    if !contains(groupOrders, groupOrder) {
+        fmt.Fprintf(os.Stderr, "%s: unknown -group-order %q\n",
+                    os.Args[0], groupOrder)
+        os.Exit(3)
+    }
+    if !contains(keepPolicies, keep) {
+        fmt.Fprintf(os.Stderr, "%s: unknown -keep policy %q\n",
+                    os.Args[0], keep)
+        os.Exit(3)
+    }
+
+    for _, root := range roots {
+        if _, err := os.Stat(root); os.IsNotExist(err) {
+            fmt.Fprintf(os.Stderr, "%s: no such directory: %s\n",
+                        os.Args[0], root)
+            os.Exit(2)
+        } else if err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+            os.Exit(2)
+        }
+    }
+    roots = distinctRoots(roots)
+    if diff && len(roots) != 2 {
+        fmt.Fprintf(os.Stderr, "%s: -diff: the roots overlap\n", os.Args[0])
+        os.Exit(2)
+    }
+    // The baseline is walked as one more root, which mustn't overlap the
+    // others.
+    if against != "" {
+        if _, err := os.Stat(against); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: -compare-against: %s\n", os.Args[0],
+                        err)
+            os.Exit(2)
+        }
+        n := len(roots)
+        if roots = distinctRoots(append(roots, against)); len(roots) != n + 1 {
+            fmt.Fprintf(os.Stderr, "%s: -compare-against: the baseline"+
+                        " overlaps the roots\n", os.Args[0])
+            os.Exit(2)
+        }
+    }
 
-    byhash := make(map[string][]string)
+    var err error
+    var hashArgs, completeArgs []string
+    if hashArgs, err = splitCommand(hashCmd); err != nil {
+        fmt.Fprintf(os.Stderr, "%s: -hash-cmd: %s\n", os.Args[0], err)
+        os.Exit(3)
+    }
+    if completeArgs, err = splitCommand(onComplete); err != nil {
+        fmt.Fprintf(os.Stderr, "%s: -on-complete: %s\n", os.Args[0], err)
+        os.Exit(3)
+    }
+    var tmpl *template.Template
+    if tmplText != "" {
+        if tmpl, err = template.New("group").Parse(tmplText); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: -template: %s\n", os.Args[0], err)
+            os.Exit(3)
+        }
+    }
+    var excludeRE, includeRE, muteRE *regexp.Regexp
+    if exclude != "" {
+        if excludeRE, err = regexp.Compile(exclude); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: -exclude-re: %s\n", os.Args[0], err)
+            os.Exit(3)
+        }
+    }
+    if include != "" {
+        if includeRE, err = regexp.Compile(include); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: -include-re: %s\n", os.Args[0], err)
+            os.Exit(3)
+        }
+    }
+    if mute != "" {
+        if muteRE, err = regexp.Compile(mute); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: -mute-error: %s\n", os.Args[0], err)
+            os.Exit(3)
+        }
+    }
+    var known map[string]bool
+    if baseline != "" {
+        if known, err = readManifest(baseline); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: -compare-with: %s\n", os.Args[0], err)
+            os.Exit(2)
+        }
+    }
+    var mounts map[string]bool
+    if skipMnt {
+        if mounts, err = mountPoints(); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: -skip-mounts: %s\n", os.Args[0], err)
+            os.Exit(2)
+        }
+    }
+
+    // Don't let a scan find its own output from an earlier run.
+    var outputs []string
+    if script != "" {
+        outputs = append(outputs, script)
+    }
+    if splitDir != "" {
+        outputs = append(outputs, splitDir)
+    }
+    if manifest != "" {
+        outputs = append(outputs, manifest)
+    }
+    if cpuProfile != "" {
+        outputs = append(outputs, cpuProfile)
+    }
+    if memProfile != "" {
+        outputs = append(outputs, memProfile)
+    }
+    if cachePath != "" {
+        outputs = append(outputs, cachePath, cachePath + ".tmp")
+    }
+    if sqlitePath != "" {
+        outputs = append(outputs, sqlitePath, sqlitePath + "-journal",
+                         sqlitePath + "-wal", sqlitePath + "-shm")
+    }
+
+    o := NewOptions(
+        WithArchives(scanArchives),
+        WithExclude(excludeRE),
+        WithExcludeDirs(excludeDirs...),
+        WithExcludeGlobs(excludeGlobs...),
+        WithExcludeSizes(excludeSizes.sizes()...),
+        WithFollowSymlinks(follow),
+        WithHashCmd(hashArgs),
+        WithIgnoreEOL(ignoreEOL, eolMax),
+        WithIgnoreLoops(ignoreLoops),
+        WithInclude(includeRE),
+        WithIncludeGlobs(includeGlobs...),
+        WithJobs(jobs),
+        WithMaxFiles(maxFiles),
+        WithMaxReadRate(readRate),
+        WithMaxSize(maxBytes),
+        WithMemBudget(budget),
+        WithMinSize(minBytes),
+        WithNormalizeText(normalizeText),
+        WithProbeFirstBlock(probeFirst),
+        WithQueue(queue),
+        WithRetries(retries),
+        WithSample(sampleRate),
+        WithSkipHeader(header),
+        WithSkipLocked(skipLocked),
+        WithSkipMounts(mounts),
+        WithSkipPaths(outputs...),
+        WithSkipSparse(skipSparse),
+    )
+    // Which entries of the cache are valid depends on the options above.
+    if cachePath != "" {
+        cache, err := loadCache(cachePath, rebuild, o)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s: -cache: %s\n", os.Args[0], err)
+            os.Exit(2)
+        }
+        WithCache(cache)(o)
+    }
 
     errors = make(chan error, 10)
-    hashdone := make(chan empty, 10)
-    paths := make(chan pathInfo, 10)
 
-    go hash(paths, byhash, hashdone)
-    if !quiet {
-        go func() {
-            for e := range errors {
-                fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], e)
+    if showProgress {
+        prog = newProgress()
+        go prog.run()
+    }
+
+    // Always drained, even with -quiet, or senders would block once the
+    // buffer filled up.
+    errlog := newErrorLog(muteRE, quiet)
+    go errlog.run()
+
+    if selfTest {
+        os.Exit(runSelfTest())
+    }
+
+    produce := func(paths chan<- pathInfo) int {
+        if fromStdin {
+            delim := byte('\n')
+            if read0 {
+                delim = 0
             }
-        }()
+            return readPaths(os.Stdin, delim, paths, o)
+        }
+        return walk(roots, paths, o)
     }
 
-    exitcode := walk(root, paths)
-    <-hashdone
+    // The CPU profile covers the walk and hashing, up to when scanned is
+    // called; the heap profile is taken and the cache saved then.
+    stopCPU, err := startCPUProfile(cpuProfile)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s: -cpuprofile: %s\n", os.Args[0], err)
+        os.Exit(1)
+    }
+    scanned := func() {
+        stopCPU()
+        if memProfile != "" {
+            if err := writeMemProfile(memProfile); err != nil {
+                fmt.Fprintf(os.Stderr, "%s: -memprofile: %s\n", os.Args[0],
+                            err)
+            }
+        }
+        if err := o.Cache.save(); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: -cache: %s\n", os.Args[0], err)
+        }
+    }
+
+    if cdc {
+        stats, exitcode := cdcScan(produce, o)
+        prog.stop()
+        close(errors)
+        errlog.wait()
+        scanned()
+        stats.print()
+        os.Exit(exitcode)
+    }
+
+    if countOnly {
+        exitcode := countHashes(produce, o)
+        prog.stop()
+        close(errors)
+        errlog.wait()
+        scanned()
+        os.Exit(exitcode)
+    }
+
+    if hashOnly {
+        exitcode := printHashes(os.Stdout, produce, o)
+        prog.stop()
+        close(errors)
+        errlog.wait()
+        scanned()
+        os.Exit(exitcode)
+    }
+
+    if nameColl {
+        byhash, exitcode := hashAll(produce, o, true)
+        prog.stop()
+        close(errors)
+        errlog.wait()
+        scanned()
+        cols := nameCollisions(byhash)
+        if format == "jsonl" {
+            err = writeCollisionsJSONL(os.Stdout, cols)
+        } else {
+            err = writeCollisions(os.Stdout, cols, showHash)
+        }
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+            exitcode = 1
+        }
+        os.Exit(exitcode)
+    }
+
+    // What's done to the groups found by any scan before they're
+    // reported, including each group that -watch reports.
+    shape := func(groups []group) []group {
+        if resolve {
+            groups = resolveGroups(groups)
+        }
+        for _, g := range groups {
+            orderGroup(g, groupOrder)
+        }
+        if sameMode {
+            groups = splitByMode(groups)
+        }
+        groups = applyHardlinks(groups, hardlinks)
+        // Before salting, which would hide all-zero contents.
+        if detectZero {
+            groups = dropZeros(groups, o.SkipHeader)
+        }
+        if minCopies > 2 {
+            groups = filterGroups(groups, func(g group) bool {
+                return len(g) >= minCopies
+            })
+        }
+        if salt != "" {
+            saltGroups(groups, salt)
+        }
+        return groups
+    }
+
+    if watchTree {
+        os.Exit(watchMode(roots, produce, o, shape, format, textStyle{
+            print0, showHash, linkReport, nil, tmpl, nil,
+        }))
+    }
+
+    groups, exitcode := scan(produce, o)
+    prog.stop()
     close(errors)   // must close here because of multiple producers
+    errlog.wait()
+    scanned()
+
+    groups = shape(groups)
+
+    // All groups go into the manifest, so the next run knows them.
+    if manifest != "" {
+        if err := writeManifest(manifest, groups); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+            exitcode = 1
+        }
+    }
+    if known != nil {
+        groups = filterGroups(groups, func(g group) bool {
+            return !known[g.id()]
+        })
+    }
+
+    if crossRoot || diff {
+        groups = filterGroups(groups, spansRoots)
+    }
+    if crossFS {
+        groups = filterGroups(groups, spansDevices)
+    }
+    if against != "" {
+        groups = filterGroups(groups, func(g group) bool {
+            return spansRoots(g) && underRoot(g, against)
+        })
+        for _, g := range groups {
+            baselineLast(g, against)
+        }
+    }
+    if diff {
+        for _, g := range groups {
+            sortBySide(g, roots[0])
+        }
+    }
+
+    if topN > 0 {
+        groups = top(groups, topN, topBy)
+    }
+
+    if compareXattr {
+        compareXattrs(groups)
+    }
+
+    var explainer func(group) *explanation
+    if explainGroups {
+        explainer = func(g group) *explanation { return explain(g, o) }
+    }
+    var total *jsonCount
+    if count {
+        total = &jsonCount{len(groups), redundant(groups, hardlinks)}
+    }
+
+    // Groups that -interactive and -gen-script should act on.
+    acting := groups
+    if !allowCrossUser && (interact || script != "" || action != "") {
+        acting = filterGroups(groups, sameOwner)
+    }
+
+    switch {
+    case interact:
+        if code := interactive(acting); code != 0 {
+            exitcode = code
+        }
+    case format == "jsonl":
+        err = writeJSONL(os.Stdout, groups, total, explainer, times)
+    case format == "json":
+        err = writeJSON(os.Stdout, groups, total, explainer, times)
+    case format == "csv":
+        err = writeCSV(os.Stdout, groups, times)
+    default:
+        err = writeText(os.Stdout, groups,
+                        textStyle{print0, showHash, linkReport, total,
+                                  tmpl, explainer})
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+        exitcode = 1
+    }
+
+    if sampleRate < 1 {
+        printEstimate(groups, sampleRate)
+    }
+
+    if byDir {
+        printTally("directory", tallyBy(groups, directory))
+    }
+    if statsByExt {
+        printTally("extension", tallyBy(groups, extension))
+    }
+
+    if splitDir != "" {
+        if err := writeSplit(splitDir, groups, print0); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+            exitcode = 1
+        }
+    }
+
+    if sqlitePath != "" {
+        if err := writeSQLite(sqlitePath, groups); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+            exitcode = 1
+        }
+    }
+
+    if script != "" {
+        if err := genScript(script, acting, keep, link); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+            exitcode = 1
+        }
+    }
+
+    if action != "" {
+        n, size := actionable(acting, action, keep, hardlinks)
+        switch {
+        case n == 0:
+        case !yes && !dryRun && !confirm(actionVerbs[action], n, size):
+            exitcode = 1
+        default:
+            code := act(acting, action, keep, hardlinks, dryRun)
+            if code != 0 {
+                exitcode = code
+            }
+        }
+    }
 
-    for _, paths := range byhash {
-        if len(paths) > 1 {
-            fmt.Println(strings.Join(paths, " "))
+    // Last, so the command sees the results of everything else.
+    if onComplete != "" {
+        err := runOnComplete(completeArgs, groups)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+            exitcode = 1
         }
     }
 
     os.Exit(exitcode)
 }
 
-// Hash what comes out of paths and store it in byhash.
-func hash(paths <-chan pathInfo, byhash map[string][]string,
-          done chan<- empty) {
-    for path := range paths {
-        h, err := hashFile(path.path, path.size)
-        if err == nil {
-            byhash[h] = append(byhash[h], path.path)
-        } else {
-            errors <- err
+func contains(list []string, s string) bool {
+    for _, t := range list {
+        if t == s {
+            return true
         }
     }
+    return false
+}
+
+func usage() {
+    fmt.Fprintf(os.Stderr, "usage: %s [flags] [root...]\n"+
+                "       %s -from-stdin [-read0] [flags]\n",
+                os.Args[0], os.Args[0])
+    os.Exit(3)
+}
+
+// Hash the files that produce pushes on the channel it's given, which it
+// must close when done, and return the groups of duplicates among them
+// along with produce's exit code.
+func scan(produce func(paths chan<- pathInfo) int,
+          o *Options) (groups []group, exitcode int) {
+    byhash, exitcode := hashAll(produce, o, false)
+    return duplicates(byhash, o), exitcode
+}
+
+// Hash the files that produce pushes on the channel it's given, and
+// return them by hash, with produce's exit code. Unless every is set,
+// only files that may have duplicates are hashed (see candidates).
+func hashAll(produce func(paths chan<- pathInfo) int, o *Options,
+             every bool) (byhash map[string]group, exitcode int) {
+    byhash = make(map[string]group)
+    hashdone := make(chan empty, 10)
+    paths := make(chan pathInfo, o.Queue)
+
+    // Archives are read in parallel with the loose files, into a map of
+    // their own that is merged into byhash afterwards, so that loose
+    // files and archive entries with the same contents form one group.
+    var archives chan pathInfo
+    inArchives := make(map[string]group)
+    if o.Archives {
+        archives = make(chan pathInfo, o.Queue)
+        go func() {
+            for a := range archives {
+                hashArchive(a, inArchives, o)
+            }
+            hashdone <- empty{}
+        }()
+    }
+
+    if every {
+        go hash(paths, byhash, archives, o, hashdone)
+    } else {
+        probed := make(chan pathInfo, o.Queue)
+        go candidates(paths, probed, o)
+        go hash(probed, byhash, archives, o, hashdone)
+    }
+    exitcode = produce(paths)
+    <-hashdone
+    if archives != nil {
+        close(archives)
+        <-hashdone
+    }
+    for h, g := range inArchives {
+        byhash[h] = append(byhash[h], g...)
+    }
+    return
+}
+
+// The groups of duplicates in byhash. Paths within groups are sorted, and
+// groups by their first path, so that output and keeper selection don't
+// depend on map or hashing order.
+func duplicates(byhash map[string]group, o *Options) (groups []group) {
+    for _, g := range byhash {
+        if o.MemBudget > 0 && len(g) > 1 {
+            g = restat(g)
+        }
+        if len(g) > 1 {
+            sort.Slice(g, func(i, j int) bool {
+                return g[i].path < g[j].path
+            })
+            groups = append(groups, g)
+        }
+    }
+    sort.Slice(groups, func(i, j int) bool {
+        return groups[i][0].path < groups[j][0].path
+    })
+    return
+}
+
+// Hash the files on paths into byhash, with o.Jobs workers. Archives
+// among them are passed on to archives, unless that's nil.
+func hash(paths <-chan pathInfo, byhash map[string]group,
+          archives chan<- pathInfo, o *Options, done chan<- empty) {
+    budget := newMemBudget(o.MemBudget)
+    var mu sync.Mutex   // guards byhash and budget
+    var wg sync.WaitGroup
+    for i := 0; i < o.Jobs; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for path := range paths {
+                h, size, err := hashFile(path.path, path.size, o)
+                if err == nil {
+                    path.hash, path.size = h, size
+                    mu.Lock()
+                    budget.add(&path, byhash)
+                    byhash[h] = append(byhash[h], path)
+                    mu.Unlock()
+                } else {
+                    errors <- err
+                }
+                if archives != nil && isArchive(path.path) {
+                    archives <- path
+                }
+                prog.addHashed(size)
+            }
+        }()
+    }
+    wg.Wait()
     done <- empty{}
 }
 
-func hashFile(path string, size int64) (h string, err error) {
+// Hash the file at path, which had the given size when it was found.
+// Since it may have changed in the meantime, its size is checked again
+// once it's open. Returns the number of bytes read, which is also the
+// file's current size; if fewer bytes could be read, that's an error.
+// A hash found in o.Cache is returned without reading the file.
+func hashFile(path string, size int64, o *Options) (h string, n int64,
+                                                   err error) {
+    defer func() {
+        if err != nil && o.SkipLocked && lockError(err) {
+            err = errLocked(path)
+        }
+    }()
+
     f, err := os.Open(path)
     if err != nil {
         return
     }
     defer f.Close()
 
+    info, err := f.Stat()
+    if err != nil {
+        return
+    }
+    if kind := special(info.Mode()); kind != "" {
+        // Replaced since it was found; reading it might never end.
+        err = fmt.Errorf("%s: skipping %s", path, kind)
+        return
+    }
+    if o.SkipLocked && locked(f) {
+        err = errLocked(path)
+        return
+    }
+    actual := info.Size()
+    if actual != size {
+        errors <- fmt.Errorf("%s: size changed from %d to %d bytes" +
+                             " since it was found", path, size, actual)
+    }
+
+    if h, ok := o.Cache.lookup(path, info); ok {
+        return h, actual, nil
+    }
+    defer func() {
+        if err == nil {
+            o.Cache.store(path, info, h)
+        }
+    }()
+
+    if o.HashCmd != nil {
+        h, err = runHashCmd(o.HashCmd, path)
+        return h, actual, err
+    }
+
+    if o.SkipHeader > 0 && actual <= o.SkipHeader {
+        err = fmt.Errorf("%s: skipping file of %d bytes, not longer than"+
+                         " -skip-header-bytes", path, actual)
+        return
+    }
+
+    if norm := o.normalizer(path, actual); norm != nil {
+        var text []byte
+        if text, err = io.ReadAll(o.limiter.reader(f)); err != nil {
+            return
+        }
+        n = int64(len(text))
+        if n != actual {
+            err = shortRead(path, n, actual)
+            return
+        }
+        text = norm(text)
+        h, _, err = hashReader(bytes.NewReader(text), int64(len(text)))
+        return
+    }
+
+    // The size hashed is that of the contents after the header.
+    st := hashState{skip: o.SkipHeader}
+    h, n, err = hashChunks(f, actual - st.skip, &st, o.limiter)
+    for try := 0; err != nil && try < o.Retries; try++ {
+        errors <- fmt.Errorf("%s; retrying from byte %d", err, st.offset)
+        h, n, err = resume(path, info, &st, o.limiter)
+    }
+    if err == nil && n != actual - st.skip {
+        err = shortRead(path, st.skip + n, actual)
+    }
+    return h, st.skip + n, err
+}
+
+// Hash size followed by the contents of r. Returns the number of bytes
+// read, which callers should check against size: the hash of a partially
+// read file means nothing.
+func hashReader(r io.Reader, size int64) (h string, n int64, err error) {
     sha := sha1.New()
     binary.Write(sha, binary.BigEndian, size)
-    _, err = io.Copy(sha, f)
+    n, err = io.Copy(sha, r)
     if err != nil {
         return
     }
@@ -108,27 +1109,315 @@ func hashFile(path string, size int64) (h string, err error) {
     return
 }
 
-// Walk root recursively, pushing regular files' paths on the channel.
-func walk(root string, paths chan<- pathInfo) (exitcode int) {
-    visit := func(path string, info os.FileInfo, err error) error {
-        if err == nil {
-            if info.Mode() & os.ModeType == 0 {
-                // regular file
-                paths <- pathInfo{path, info.Size()}
+// The error for a file skipped by -skip-locked.
+func errLocked(path string) error {
+    return fmt.Errorf("%s: skipping file locked by another process", path)
+}
+
+// The error for a file of which n bytes could be read instead of size.
+func shortRead(path string, n, size int64) error {
+    return fmt.Errorf("%s: read %d bytes, expected %d; not hashed",
+                      path, n, size)
+}
+
+// Walk each root recursively, pushing regular files' paths on the channel.
+func walk(roots []string, paths chan<- pathInfo, o *Options) (exitcode int) {
+    w := &walker{o: o, paths: paths}
+    if o.FollowSymlinks != "none" {
+        w.visited = make(map[fileID]bool)
+    }
+    if o.FollowSymlinks == "external-only" {
+        for _, root := range roots {
+            if real, err := realPath(root); err == nil {
+                w.realRoots = append(w.realRoots, real)
             }
-        } else {
-            errors <- err
-            exitcode = 1
+        }
+    }
+
+    for _, root := range roots {
+        if w.walkRoot(root); w.stop {
+            break
+        }
+    }
+
+    close(paths)
+    return w.exitcode
+}
+
+// State of a walk over one or more roots.
+type walker struct {
+    o         *Options
+    paths     chan<- pathInfo
+    n         int       // files queued so far
+    realRoots []string  // with FollowSymlinks "external-only", see internal
+    visited   map[fileID]bool   // directories walked, if following links
+    stop      bool      // set when the MaxFiles cap is reached
+    exitcode  int
+}
+
+// Walk a single root.
+func (w *walker) walkRoot(root string) {
+    absRoot, err := filepath.Abs(root)
+    if err != nil {
+        w.error(err)
+        return
+    }
+    w.walkTree(root, root, absRoot)
+}
+
+// Walk the tree at dir, which is or is under root (absolute: absRoot).
+// Files are only stat'ed once their paths have passed the filters.
+func (w *walker) walkTree(dir, root, absRoot string) {
+    visit := func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            w.error(err)
+            return nil
+        }
+        mode := d.Type()
+        if mode.IsDir() && w.visited != nil {
+            info, err := d.Info()
+            if err != nil {
+                w.error(err)
+                return filepath.SkipDir
+            }
+            id := identify(path, info)
+            if w.visited[id] {
+                w.revisit(path)
+                return filepath.SkipDir
+            }
+            w.visited[id] = true
+        }
+        switch {
+        case w.stop:
+            return filepath.SkipAll
+        case mode.IsDir() && (w.o.own(path) ||
+                              path != root && w.o.prunedDir(path)):
+            return filepath.SkipDir
+        case mode.IsDir() && path != root && w.o.SkipMounts != nil:
+            rel, _ := filepath.Rel(root, path)
+            if w.o.SkipMounts[filepath.Join(absRoot, rel)] {
+                return filepath.SkipDir
+            }
+        case mode & os.ModeSymlink != 0 && w.o.FollowSymlinks != "none":
+            w.follow(path, root, absRoot)
+        case mode.IsRegular() && w.o.wantedPath(path):
+            info, err := d.Info()
+            if err != nil {
+                w.error(err)
+                return nil
+            }
+            w.push(pathInfo{path: path, size: info.Size(), info: info,
+                            root: root})
         }
         return nil
     }
 
-    err := filepath.Walk(root, visit)
+    if err := filepath.WalkDir(dir, visit); err != nil {
+        w.error(err)
+    }
+}
+
+// Queue a file for hashing, if it's wanted and the MaxFiles cap allows.
+func (w *walker) push(p pathInfo) {
+    if !w.o.wanted(p.path, p.info) {
+        return
+    }
+    if w.o.capReached(w.n) {
+        w.stop = true
+        return
+    }
+    w.n++
+    prog.addFound()
+    w.paths <- p
+}
+
+// Follow the symlink at path according to the FollowSymlinks policy:
+// a file it points to is checked under the link's path, and a directory
+// is walked as if it were a subdirectory.
+func (w *walker) follow(path, root, absRoot string) {
+    info, err := os.Stat(path)
     if err != nil {
+        w.error(err)        // dangling link
+        return
+    }
+    if w.o.FollowSymlinks == "external-only" {
+        real, err := realPath(path)
+        if err != nil {
+            w.error(err)
+            return
+        }
+        if w.internal(real) {
+            return
+        }
+    }
+
+    switch {
+    case info.IsDir():
+        // filepath.WalkDir doesn't follow a symlink given as its root,
+        // but does when it's written as a directory.
+        w.walkTree(path + string(os.PathSeparator), root, absRoot)
+    case info.Mode().IsRegular():
+        w.push(pathInfo{path: path, size: info.Size(), info: info, root: root})
+    }
+}
+
+// Reports whether real, an absolute path without symlinks, is under one
+// of the roots.
+func (w *walker) internal(real string) bool {
+    for _, root := range w.realRoots {
+        if under(real, root) {
+            return true
+        }
+    }
+    return false
+}
+
+// Reports whether path is dir or a path inside it. Both must be clean
+// absolute paths.
+func under(path, dir string) bool {
+    rel, err := filepath.Rel(dir, path)
+    return err == nil && rel != ".." &&
+           !strings.HasPrefix(rel, ".." + string(os.PathSeparator))
+}
+
+// Drop the roots that are, or are inside, another root, with a warning,
+// so that no file is walked twice and reported as its own duplicate.
+// Roots are compared as absolute paths without symlinks; of equal ones,
+// the first is kept.
+func distinctRoots(roots []string) []string {
+    real := make([]string, len(roots))
+    for i, root := range roots {
+        var err error
+        if real[i], err = realPath(root); err != nil {
+            real[i] = filepath.Clean(root)
+        }
+    }
+
+    var kept []string
+    for i, root := range roots {
+        inside := ""
+        for j := range roots {
+            if j != i && under(real[i], real[j]) &&
+               (real[i] != real[j] || j < i) {
+                inside = roots[j]
+                break
+            }
+        }
+        if inside != "" {
+            fmt.Fprintf(os.Stderr, "%s: skipping root %s, already"+
+                        " covered by root %s\n", os.Args[0], root, inside)
+        } else {
+            kept = append(kept, root)
+        }
+    }
+    return kept
+}
+
+// Report that the directory at path was already walked, under another
+// path that goes through a symlink.
+func (w *walker) revisit(path string) {
+    err := fmt.Errorf("%s: directory already walked, skipping" +
+                      " (symlink loop?)", path)
+    if w.o.IgnoreLoops {
         errors <- err
-        exitcode = 1
+    } else {
+        w.error(err)
+    }
+}
+
+func (w *walker) error(err error) {
+    errors <- err
+    w.exitcode = 1
+}
+
+// Identifies a directory independently of the path it's reached by.
+// Only directories are tracked, so the set of them stays small even
+// for trees with millions of files.
+type fileID struct {
+    dev, ino uint64
+    real     string     // where there are no inode numbers
+}
+
+func identify(path string, info os.FileInfo) fileID {
+    if dev, ino, ok := devIno(info); ok {
+        return fileID{dev: dev, ino: ino}
+    }
+    real, err := realPath(path)
+    if err != nil {
+        real = path
+    }
+    return fileID{real: real}
+}
+
+// Returns the absolute path of path with all symlinks resolved.
+func realPath(path string) (string, error) {
+    abs, err := filepath.Abs(path)
+    if err != nil {
+        return "", err
+    }
+    return filepath.EvalSymlinks(abs)
+}
+
+// Read paths from r, one per delim-terminated record, pushing those of
+// regular files on the channel.
+func readPaths(r io.Reader, delim byte, paths chan<- pathInfo,
+               o *Options) (exitcode int) {
+    br := bufio.NewReader(r)
+    for n := 0; ; {
+        path, err := br.ReadString(delim)
+        if len(path) > 0 && path[len(path)-1] == delim {
+            path = path[:len(path)-1]
+        }
+        if path != "" {
+            if info, err := os.Stat(path); err != nil {
+                errors <- err
+                exitcode = 1
+            } else if kind := special(info.Mode()); kind != "" {
+                errors <- fmt.Errorf("%s: skipping %s", path, kind)
+            } else if info.Mode().IsRegular() && o.wanted(path, info) {
+                if o.capReached(n) {
+                    break
+                }
+                n++
+                prog.addFound()
+                paths <- pathInfo{path: path, size: info.Size(), info: info}
+            }
+        }
+        if err == io.EOF {
+            break
+        } else if err != nil {
+            errors <- err
+            exitcode = 1
+            break
+        }
     }
 
     close(paths)
     return
 }
+
+// Describes mode if it's that of a file that may block or never end when
+// read, such as a named pipe, device or socket; returns "" otherwise.
+func special(mode os.FileMode) string {
+    switch {
+    case mode & os.ModeNamedPipe != 0:
+        return "named pipe"
+    case mode & os.ModeDevice != 0:
+        return "device"
+    case mode & os.ModeSocket != 0:
+        return "socket"
+    }
+    return ""
+}
+
+// Reports whether n files have been queued and the MaxFiles cap is
+// reached, in which case a notice is printed and the producer should stop.
+// The notice goes straight to stderr, since -quiet must not hide it.
+func (o *Options) capReached(n int) bool {
+    if o.MaxFiles <= 0 || n < o.MaxFiles {
+        return false
+    }
+    fmt.Fprintf(os.Stderr, "%s: stopped after %d files (-max-files);"+
+                " results are truncated\n", os.Args[0], n)
+    return true
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "regexp"
+)
+
+// Prints what's sent on errors to stderr, except for messages matching
+// mute, which are only counted. With quiet, nothing is printed, but errors
+// is still drained so that senders never block on it.
+type errorLog struct {
+    mute    *regexp.Regexp
+    quiet   bool
+    muted   int
+    dropped int
+    done    chan empty
+}
+
+func newErrorLog(mute *regexp.Regexp, quiet bool) *errorLog {
+    return &errorLog{mute: mute, quiet: quiet, done: make(chan empty)}
+}
+
+func (l *errorLog) run() {
+    for e := range errors {
+        if l.quiet {
+            l.dropped++
+            continue
+        }
+        if l.mute != nil && l.mute.MatchString(e.Error()) {
+            l.muted++
+            continue
+        }
+        fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], e)
+    }
+    close(l.done)
+}
+
+// Wait, after errors has been closed, until everything sent on it has been
+// printed, and report how many messages were muted or dropped.
+func (l *errorLog) wait() {
+    <-l.done
+    if l.muted > 0 {
+        fmt.Fprintf(os.Stderr, "%s: %d errors not shown (-mute-error)\n",
+                    os.Args[0], l.muted)
+    }
+    if l.dropped > 0 {
+        fmt.Fprintf(os.Stderr, "%s: %d errors not shown (-quiet)\n",
+                    os.Args[0], l.dropped)
+    }
+}
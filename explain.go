@@ -0,0 +1,88 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// How dupes decided that the files of a group are duplicates, for
+// -explain.
+type explanation struct {
+    Size       *int64  `json:"size,omitempty"`    // of every file, if the same
+    Hash       string  `json:"hash"`              // what was hashed, and how
+    SizeFirst  bool    `json:"size_first"`        // see candidates
+    FirstBlock bool    `json:"first_block"`       // -probe-first-block
+    Sample     float64 `json:"sample,omitempty"`  // with -sample, the rate
+}
+
+func explain(g group, o *Options) *explanation {
+    e := &explanation{SizeFirst: sameSize(g)}
+    if e.SizeFirst {
+        e.Size = &g[0].size
+    }
+    for _, p := range g {
+        if p.inArchive() || !o.bySize(p.path, p.size) {
+            e.SizeFirst = false
+        }
+    }
+    e.FirstBlock = e.SizeFirst && o.ProbeFirst
+    switch {
+    case o.HashCmd != nil:
+        e.Hash = fmt.Sprintf("SHA-1 of the output of %q",
+                             strings.Join(o.HashCmd, " "))
+    case normalizedIn(g, o.isNormalized):
+        e.Hash = "SHA-1 of the size and text, ignoring case and line endings"
+    case normalizedIn(g, o.ignoresEOL):
+        e.Hash = "SHA-1 of the size and text, ignoring line endings"
+    case o.SkipHeader > 0:
+        e.Hash = fmt.Sprintf("SHA-1 of the size and contents after the"+
+                             " first %d bytes", o.SkipHeader)
+    default:
+        e.Hash = "SHA-1 of the size and contents"
+    }
+    if o.Sample < 1 {
+        e.Sample = o.Sample
+    }
+    return e
+}
+
+// Reports whether all files of g have the same size.
+func sameSize(g group) bool {
+    for _, p := range g[1:] {
+        if p.size != g[0].size {
+            return false
+        }
+    }
+    return true
+}
+
+// Reports whether any file of g outside archives was normalized, as told
+// by normalized.
+func normalizedIn(g group, normalized func(string, int64) bool) bool {
+    for _, p := range g {
+        if !p.inArchive() && normalized(p.path, p.size) {
+            return true
+        }
+    }
+    return false
+}
+
+func (e *explanation) String() string {
+    s := "matched on: "
+    if e.Size != nil {
+        s += fmt.Sprintf("size %d bytes, ", *e.Size)
+    }
+    s += e.Hash
+    switch {
+    case e.FirstBlock:
+        s += fmt.Sprintf("; hashed after matching size and first %d bytes",
+                         probeSize)
+    case e.SizeFirst:
+        s += "; hashed after matching size"
+    }
+    s += "; not compared byte by byte"
+    if e.Sample > 0 {
+        s += fmt.Sprintf("; found in a %g sample of the files", e.Sample)
+    }
+    return s
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+    "fmt"
+    "hash/fnv"
+    "math"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// Reports whether the file at path, described by info, should be checked
+// for duplicates. Exclusion takes precedence over inclusion.
+func (o *Options) wanted(path string, info os.FileInfo) bool {
+    return o.wantedPath(path) && o.wantedSize(info.Size()) &&
+           !o.skippedSparse(path, info)
+}
+
+func (o *Options) wantedSize(size int64) bool {
+    return size >= o.MinSize && (o.MaxSize == 0 || size <= o.MaxSize) &&
+           !o.ExcludeSizes[size]
+}
+
+// The part of wanted that only looks at path, which can be checked before
+// stat'ing the file.
+func (o *Options) wantedPath(path string) bool {
+    if o.Exclude != nil && o.Exclude.MatchString(path) ||
+       matchAny(o.ExcludeGlobs, path) || o.own(path) {
+        return false
+    }
+    return (o.Include == nil || o.Include.MatchString(path)) &&
+           (o.IncludeGlobs == nil || matchAny(o.IncludeGlobs, path)) &&
+           o.sampled(path)
+}
+
+// Reports whether the walk should skip the directory at path, other than
+// a root.
+func (o *Options) prunedDir(path string) bool {
+    return matchAny(o.ExcludeDirs, path)
+}
+
+// Reports whether path is one of the files dupes itself writes.
+func (o *Options) own(path string) bool {
+    if len(o.SkipPaths) == 0 {
+        return false
+    }
+    abs, err := filepath.Abs(path)
+    return err == nil && o.SkipPaths[abs]
+}
+
+// A file with at least this many bytes of holes counts as sparse.
+const sparseHoles = 1 << 20
+
+// With SkipSparse, reports whether the file at path, described by info,
+// is sparse and should be skipped, warning about it if so.
+func (o *Options) skippedSparse(path string, info os.FileInfo) bool {
+    if !o.SkipSparse {
+        return false
+    }
+    used, ok := allocated(info)
+    if !ok || info.Size() - used < sparseHoles {
+        return false
+    }
+    errors <- fmt.Errorf("%s: skipping sparse file (%d of %d bytes allocated)",
+                         path, used, info.Size())
+    return true
+}
+
+// Reports whether path is in the Sample. Since the choice depends only on
+// the path, repeated runs over the same tree check the same files.
+func (o *Options) sampled(path string) bool {
+    if o.Sample >= 1 {
+        return true
+    }
+    h := fnv.New64a()
+    h.Write([]byte(path))
+    return float64(h.Sum64()) < o.Sample * math.MaxUint64
+}
+
+// A set of sizes, usable as a repeatable flag.
+type sizeSet map[int64]bool
+
+func (s sizeSet) sizes() []int64 {
+    sizes := make([]int64, 0, len(s))
+    for size := range s {
+        sizes = append(sizes, size)
+    }
+    return sizes
+}
+
+func (s sizeSet) String() string {
+    sizes := make([]string, 0, len(s))
+    for size := range s {
+        sizes = append(sizes, strconv.FormatInt(size, 10))
+    }
+    return strings.Join(sizes, ",")
+}
+
+func (s sizeSet) Set(value string) error {
+    size, err := parseSize(value)
+    if err == nil {
+        s[size] = true
+    }
+    return err
+}
+
+// Parse a size in bytes with an optional binary suffix, as in 100, 4k,
+// 1.5MiB or 2G.
+func parseSize(s string) (int64, error) {
+    t := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(s), "b"), "i")
+    mult := 1.
+    if n := len(t); n > 0 {
+        if i := strings.IndexByte("kmgtpe", t[n-1]); i >= 0 {
+            mult = math.Pow(1024, float64(i + 1))
+            t = t[:n-1]
+        }
+    }
+    // MaxInt64 rounds up to 1<<63 as a float64, which doesn't fit.
+    f, err := strconv.ParseFloat(t, 64)
+    if err != nil || math.IsNaN(f) || f < 0 || f * mult >= math.MaxInt64 {
+        return 0, fmt.Errorf("invalid size %q", s)
+    }
+    return int64(f * mult), nil
+}
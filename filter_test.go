@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+    for _, c := range []struct {
+        s    string
+        want int64
+        ok   bool
+    }{
+        {"0", 0, true},
+        {"100", 100, true},
+        {"4k", 4096, true},
+        {"4K", 4096, true},
+        {"1.5MiB", 3 << 19, true},
+        {"2G", 2 << 30, true},
+        {"10mb", 10 << 20, true},
+        {"7E", 7 << 60, true},
+        {"8E", 0, false},
+        {"8192P", 0, false},
+        {"1e30", 0, false},
+        {"inf", 0, false},
+        {"nan", 0, false},
+        {"NaNk", 0, false},
+        {"-1", 0, false},
+        {"", 0, false},
+        {"k", 0, false},
+        {"4x", 0, false},
+    } {
+        n, err := parseSize(c.s)
+        switch {
+        case c.ok && err != nil:
+            t.Errorf("parseSize(%q): %s", c.s, err)
+        case !c.ok && err == nil:
+            t.Errorf("parseSize(%q) = %d, want an error", c.s, n)
+        case n != c.want:
+            t.Errorf("parseSize(%q) = %d, want %d", c.s, n, c.want)
+        }
+    }
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+    "path"
+    "path/filepath"
+    "strings"
+)
+
+// A shell pattern for -exclude, -include and -exclude-dir, matched against
+// the trailing components of a path: *.o matches any file ending in .o,
+// and src/*.c any C file directly in a directory named src. A component
+// ** matches any number of components, and a pattern starting with / is
+// matched against the whole absolute path instead.
+type glob struct {
+    pattern string
+    parts   []string
+}
+
+func parseGlob(pattern string) (glob, error) {
+    p := filepath.ToSlash(pattern)
+    parts := strings.Split(strings.Trim(p, "/"), "/")
+    for _, part := range parts {
+        if _, err := path.Match(part, ""); err != nil {
+            return glob{}, err
+        }
+    }
+    if strings.HasPrefix(p, "/") {
+        parts = append([]string{""}, parts...)
+    } else {
+        parts = append([]string{"**"}, parts...)
+    }
+    return glob{pattern, parts}, nil
+}
+
+func (g glob) match(name string) bool {
+    if g.parts[0] == "" {
+        if abs, err := filepath.Abs(name); err == nil {
+            name = abs
+        }
+    }
+    name = filepath.ToSlash(filepath.Clean(name))
+    return matchParts(g.parts, strings.Split(name, "/"))
+}
+
+func matchParts(pattern, parts []string) bool {
+    for ; len(pattern) > 0; pattern, parts = pattern[1:], parts[1:] {
+        if pattern[0] == "**" {
+            for i := 0; i <= len(parts); i++ {
+                if matchParts(pattern[1:], parts[i:]) {
+                    return true
+                }
+            }
+            return false
+        }
+        if len(parts) == 0 {
+            return false
+        }
+        if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+            return false
+        }
+    }
+    return len(parts) == 0
+}
+
+// Reports whether any of globs matches name.
+func matchAny(globs []glob, name string) bool {
+    for _, g := range globs {
+        if g.match(name) {
+            return true
+        }
+    }
+    return false
+}
+
+// A list of globs, usable as a repeatable flag.
+type globList []glob
+
+func (l *globList) String() string {
+    patterns := make([]string, len(*l))
+    for i, g := range *l {
+        patterns[i] = g.pattern
+    }
+    return strings.Join(patterns, ",")
+}
+
+func (l *globList) Set(value string) error {
+    g, err := parseGlob(value)
+    if err == nil {
+        *l = append(*l, g)
+    }
+    return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "runtime"
+    "testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+    for _, c := range []struct {
+        pattern, name string
+        want          bool
+    }{
+        {"*.o", "foo.o", true},
+        {"*.o", "src/lib/foo.o", true},
+        {"*.o", "foo.c", false},
+        {"*.o", "foo.o/bar", false},
+        {"*", "foo", true},
+        {"f?o", "src/foo", true},
+        {"[a-c]*", "src/bar", true},
+        {"[a-c]*", "src/foo", false},
+
+        {"src/*.c", "src/main.c", true},
+        {"src/*.c", "proj/src/main.c", true},
+        {"src/*.c", "src/sub/main.c", false},
+        {"src/*.c", "lib/main.c", false},
+        {"src/", "proj/src", true},
+        {"node_modules", "a/node_modules", true},
+        {".git", "repo/.git", true},
+        {".git", "repo/.github", false},
+
+        {"**", "a/b/c", true},
+        {"src/**/*.c", "src/main.c", true},
+        {"src/**/*.c", "src/a/b/main.c", true},
+        {"src/**/*.c", "lib/a/main.c", false},
+        {"a/**", "a/b/c", true},
+        {"a/**", "b/c", false},
+    } {
+        testMatch(t, c.pattern, c.name, c.want)
+    }
+}
+
+// Patterns starting with / are matched against absolute paths.
+func TestGlobMatchAbsolute(t *testing.T) {
+    if runtime.GOOS == "windows" {
+        t.Skip("absolute paths start with a volume name")
+    }
+    wd, err := os.Getwd()
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, c := range []struct {
+        pattern, name string
+        want          bool
+    }{
+        {"/main.c", "main.c", false},
+        {wd + "/*.c", "main.c", true},
+        {wd + "/*.c", "src/main.c", false},
+        {wd + "/**/*.c", "src/main.c", true},
+        {"/**/main.c", "src/main.c", true},
+        {"/etc/*.conf", "/etc/foo.conf", true},
+        {"/etc/*.conf", "/usr/etc/foo.conf", false},
+        {"/etc/*.conf", "foo.conf", false},
+    } {
+        testMatch(t, c.pattern, c.name, c.want)
+    }
+}
+
+func testMatch(t *testing.T, pattern, name string, want bool) {
+    t.Helper()
+    g, err := parseGlob(pattern)
+    if err != nil {
+        t.Errorf("parseGlob(%q): %s", pattern, err)
+    } else if got := g.match(filepath.FromSlash(name)); got != want {
+        t.Errorf("%q matching %q = %t, want %t", pattern, name, got, want)
+    }
+}
+
+func TestParseGlobMalformed(t *testing.T) {
+    for _, pattern := range []string{"[", "a/[b", "[]", "src/\\", "[a-/b"} {
+        if _, err := parseGlob(pattern); err == nil {
+            t.Errorf("parseGlob(%q) succeeded, want an error", pattern)
+        }
+    }
+}
+
+func TestGlobList(t *testing.T) {
+    // Not a directory that the working directory can be in.
+    dir := t.TempDir()
+    tmp := filepath.ToSlash(dir) + "/**"
+    var l globList
+    for _, pattern := range []string{"*.o", tmp} {
+        if err := l.Set(pattern); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := l.Set("["); err == nil {
+        t.Error(`Set("[") succeeded, want an error`)
+    }
+    if s, want := l.String(), "*.o," + tmp; s != want {
+        t.Errorf("String() = %q, want %q", s, want)
+    }
+    if !matchAny(l, "a/b.o") || matchAny(l, "a/b.c") ||
+       !matchAny(l, filepath.Join(dir, "a", "b.c")) {
+        t.Error("matchAny gives the wrong answer")
+    }
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Hash the files pushed on paths and write each one's hash and path to
+// out as soon as it's known, without collecting them: memory use doesn't
+// grow with the number of files. Files are hashed by o.Jobs workers, so
+// they're written in no particular order.
+func printHashes(out io.Writer, produce func(paths chan<- pathInfo) int,
+                 o *Options) (exitcode int) {
+    w := bufio.NewWriter(out)
+    var mu sync.Mutex   // guards w
+    paths := make(chan pathInfo, o.Queue)
+    done := make(chan empty)
+
+    for i := 0; i < o.Jobs; i++ {
+        go func() {
+            for p := range paths {
+                h, size, err := hashFile(p.path, p.size, o)
+                var entries map[string]group
+                if o.Archives && isArchive(p.path) {
+                    entries = make(map[string]group)
+                    hashArchive(p, entries, o)
+                }
+                if err != nil {
+                    errors <- err
+                }
+                mu.Lock()
+                if err == nil {
+                    fmt.Fprintf(w, "%x\t%s\n", h, p.path)
+                }
+                printEntries(w, entries)
+                mu.Unlock()
+                prog.addHashed(size)
+            }
+            done <- empty{}
+        }()
+    }
+    exitcode = produce(paths)
+    for i := 0; i < o.Jobs; i++ {
+        <-done
+    }
+
+    if err := w.Flush(); err != nil {
+        fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+        exitcode = 1
+    }
+    return
+}
+
+// Write the hashes and paths of the archive entries in byhash, in the
+// order of their paths.
+func printEntries(w io.Writer, byhash map[string]group) {
+    var entries []pathInfo
+    for _, g := range byhash {
+        entries = append(entries, g...)
+    }
+    sort.Slice(entries, func(i, j int) bool {
+        return entries[i].path < entries[j].path
+    })
+    for _, p := range entries {
+        fmt.Fprintf(w, "%x\t%s\n", p.hash, p.path)
+    }
+}
+
+// Hash the files pushed on paths, discarding the hashes, and report how
+// many files and bytes were hashed and how fast, for -count-only: this
+// measures reading and hashing without the cost of grouping and output.
+// Files are hashed by o.Jobs workers, as in a scan.
+func countHashes(produce func(paths chan<- pathInfo) int,
+                 o *Options) (exitcode int) {
+    paths := make(chan pathInfo, o.Queue)
+    done := make(chan empty)
+    var files, bytes atomic.Int64
+    start := time.Now()
+
+    for i := 0; i < o.Jobs; i++ {
+        go func() {
+            for p := range paths {
+                _, size, err := hashFile(p.path, p.size, o)
+                if err != nil {
+                    errors <- err
+                } else {
+                    files.Add(1)
+                    bytes.Add(size)
+                }
+                prog.addHashed(size)
+            }
+            done <- empty{}
+        }()
+    }
+    exitcode = produce(paths)
+    for i := 0; i < o.Jobs; i++ {
+        <-done
+    }
+
+    elapsed := time.Since(start).Seconds()
+    rate := 0.
+    if elapsed > 0 {
+        rate = float64(bytes.Load()) / elapsed / 1e6
+    }
+    fmt.Printf("%d files, %d bytes in %.2fs (%.1f MB/s)\n",
+               files.Load(), bytes.Load(), elapsed, rate)
+    return
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+    "fmt"
+    "path/filepath"
+    "syscall"
+    "unsafe"
+)
+
+const canWatch = true
+
+// Changes to directories, reported by inotify(7).
+type dirWatcher struct {
+    fd   int
+    dirs map[int32]string   // watch descriptor -> directory
+    buf  []byte
+}
+
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE |
+                  syscall.IN_DELETE | syscall.IN_MOVED_FROM |
+                  syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF |
+                  syscall.IN_ONLYDIR
+
+func newDirWatcher() (*dirWatcher, error) {
+    fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+    if err != nil {
+        return nil, fmt.Errorf("inotify: %s", err)
+    }
+    return &dirWatcher{fd: fd, dirs: make(map[int32]string),
+                       buf: make([]byte, 64 << 10)}, nil
+}
+
+// Watch the directory dir itself, not its subdirectories.
+func (w *dirWatcher) add(dir string) error {
+    wd, err := syscall.InotifyAddWatch(w.fd, dir, watchMask)
+    if err != nil {
+        return fmt.Errorf("%s: inotify: %s", dir, err)
+    }
+    w.dirs[int32(wd)] = dir
+    return nil
+}
+
+// Wait for changes and return them.
+func (w *dirWatcher) next() ([]fsEvent, error) {
+    n, err := syscall.Read(w.fd, w.buf)
+    if err != nil {
+        return nil, fmt.Errorf("inotify: %s", err)
+    }
+
+    var events []fsEvent
+    for off := 0; off + syscall.SizeofInotifyEvent <= n; {
+        raw := (*syscall.InotifyEvent)(unsafe.Pointer(&w.buf[off]))
+        name := w.buf[off + syscall.SizeofInotifyEvent:
+                      off + syscall.SizeofInotifyEvent + int(raw.Len)]
+        off += syscall.SizeofInotifyEvent + int(raw.Len)
+
+        if raw.Mask & syscall.IN_Q_OVERFLOW != 0 {
+            events = append(events, fsEvent{overflow: true})
+            continue
+        }
+        dir, ok := w.dirs[raw.Wd]
+        if !ok {
+            continue
+        }
+        if raw.Mask & (syscall.IN_DELETE_SELF | syscall.IN_IGNORED) != 0 {
+            delete(w.dirs, raw.Wd)
+            continue
+        }
+        for len(name) > 0 && name[len(name) - 1] == 0 {
+            name = name[:len(name) - 1]
+        }
+        path := filepath.Join(dir, string(name))
+        isDir := raw.Mask & syscall.IN_ISDIR != 0
+
+        switch {
+        case raw.Mask & (syscall.IN_DELETE | syscall.IN_MOVED_FROM) != 0:
+            events = append(events, fsEvent{path: path, dir: isDir,
+                                            removed: true})
+        case raw.Mask & (syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO) != 0,
+             raw.Mask & syscall.IN_CREATE != 0 && isDir:
+            // A new file is only hashed once it has been written.
+            events = append(events, fsEvent{path: path, dir: isDir})
+        }
+    }
+    return events, nil
+}
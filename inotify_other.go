@@ -0,0 +1,22 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// Watching needs inotify(7), so -watch is refused before scanning.
+const canWatch = false
+
+type dirWatcher struct{}
+
+func newDirWatcher() (*dirWatcher, error) {
+    return nil, fmt.Errorf("-watch is only supported on Linux")
+}
+
+func (w *dirWatcher) add(dir string) error {
+    return nil
+}
+
+func (w *dirWatcher) next() ([]fsEvent, error) {
+    return nil, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "runtime"
+    "strconv"
+    "strings"
+)
+
+// Name of the controlling terminal, from which -interactive reads answers
+// even when stdin is redirected.
+func ttyName() string {
+    if runtime.GOOS == "windows" {
+        return "CONIN$"
+    }
+    return "/dev/tty"
+}
+
+// For each group, ask on the terminal which files to keep, then remove the
+// others, except for archive entries and files that are a kept file under
+// another path. Returns the exit code: 1 if a file couldn't be removed.
+func interactive(groups []group) (exitcode int) {
+    tty, err := os.Open(ttyName())
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s: -interactive: %s\n", os.Args[0], err)
+        return 1
+    }
+    defer tty.Close()
+    in := bufio.NewReader(tty)
+
+    for i, g := range groups {
+        fmt.Fprintf(os.Stderr, "\n")
+        for j, p := range g {
+            note := ""
+            if p.inArchive() {
+                note = " (in archive, can't be removed)"
+            }
+            fmt.Fprintf(os.Stderr, "[%d] %s%s\n", j + 1, p.path, note)
+        }
+
+        var keep map[int]bool
+        for keep == nil {
+            fmt.Fprintf(os.Stderr, "Set %d of %d: keep which files?"+
+                        " (numbers, s to skip, q to quit) ",
+                        i + 1, len(groups))
+            line, err := in.ReadString('\n')
+            if err != nil {
+                fmt.Fprintln(os.Stderr)
+                return
+            }
+            switch line = strings.TrimSpace(line); line {
+            case "q":
+                return
+            case "s":
+                keep = map[int]bool{}
+                for j := range g {
+                    keep[j] = true
+                }
+            default:
+                keep = parseChoice(line, len(g))
+            }
+        }
+
+        real := make(map[int]string)
+        for j := range keep {
+            real[j], _ = realPath(g[j].path)
+        }
+        for j, p := range g {
+            if keep[j] || p.inArchive() {
+                continue
+            }
+            if err := safeToRemove(p, g, real); err != nil {
+                fmt.Fprintf(os.Stderr, "%s: %s; left alone\n", os.Args[0],
+                            err)
+                continue
+            }
+            if err := os.Remove(p.path); err != nil {
+                fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+                exitcode = 1
+            } else {
+                fmt.Fprintf(os.Stderr, "removed %s\n", p.path)
+            }
+        }
+    }
+    return
+}
+
+// Returns why p mustn't be removed while keeping the files of g at the
+// indices in real, which maps them to their realPaths, if so: it may be
+// one of them under another path.
+func safeToRemove(p pathInfo, g group, real map[int]string) error {
+    for j, k := range g {
+        if rk, ok := real[j]; ok {
+            if err := safeToAct(p, k, rk, "delete"); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// Parse a list of file numbers between 1 and n, separated by spaces or
+// commas, into a set of indices. Returns nil if the list is invalid or
+// empty: at least one file must be kept.
+func parseChoice(line string, n int) map[int]bool {
+    keep := make(map[int]bool)
+    for _, f := range strings.FieldsFunc(line, func(r rune) bool {
+        return r == ',' || r == ' ' || r == '\t'
+    }) {
+        k, err := strconv.Atoi(f)
+        if err != nil || k < 1 || k > n {
+            return nil
+        }
+        keep[k-1] = true
+    }
+    if len(keep) == 0 {
+        return nil
+    }
+    return keep
+}
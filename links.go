@@ -0,0 +1,102 @@
+package main
+
+import "fmt"
+
+var hardlinkPolicies = []string{"separate", "merge", "skip"}
+
+// Apply the -hardlinks policy to groups: with "merge", hard links to the
+// same file count as one copy, so groups of links to a single file are
+// dropped; with "skip", only the first path of each file is kept.
+// Files without an inode number count as distinct.
+func applyHardlinks(groups []group, policy string) []group {
+    if policy == "separate" {
+        return groups
+    }
+    var kept []group
+    for _, g := range groups {
+        var files group
+        seen := make(map[fileID]bool)
+        for _, p := range g {
+            if id, ok := linkedFile(p); !ok || !seen[id] {
+                seen[id] = true
+                files = append(files, p)
+            }
+        }
+        switch {
+        case len(files) < 2:
+        case policy == "skip":
+            kept = append(kept, files)
+        default:
+            kept = append(kept, g)
+        }
+    }
+    return kept
+}
+
+// The file that p is a hard link to, if it has an inode number.
+func linkedFile(p pathInfo) (id fileID, ok bool) {
+    if p.info != nil && !p.inArchive() {
+        id.dev, id.ino, ok = devIno(p.info)
+    }
+    return
+}
+
+// The number of files in g, counting hard links to the same file as one
+// unless the -hardlinks policy is "separate".
+func copies(g group, policy string) int {
+    if policy == "separate" {
+        return len(g)
+    }
+    n := 0
+    seen := make(map[fileID]bool)
+    for _, p := range g {
+        if id, ok := linkedFile(p); !ok || !seen[id] {
+            seen[id] = true
+            n++
+        }
+    }
+    return n
+}
+
+// Describe how the members of g could be hard-linked together: whether they
+// all live on one file system, how many bytes linking would free and
+// whether some of them are already hard links to each other.
+func linkDetails(g group) string {
+    inodes := make(map[uint64]map[uint64]bool)  // device -> set of inodes
+    files, distinct := 0, 0
+    for _, p := range g {
+        dev, ino, ok := devIno(p.info)
+        if !ok {
+            continue    // e.g., an archive entry
+        }
+        files++
+        if inodes[dev] == nil {
+            inodes[dev] = make(map[uint64]bool)
+        }
+        if !inodes[dev][ino] {
+            inodes[dev][ino] = true
+            distinct++
+        }
+    }
+
+    // Linking can only merge files on the same device.
+    var savings int64
+    for _, set := range inodes {
+        savings += int64(len(set) - 1) * g[0].size
+    }
+
+    sameFS := "no"
+    if files == len(g) && len(inodes) == 1 {
+        sameFS = "yes"
+    }
+    linked := "no"
+    switch {
+    case files == len(g) && distinct == 1:
+        linked = "yes"
+    case distinct < files:
+        linked = "partly"
+    }
+
+    return fmt.Sprintf("same-fs: %s, savings: %d bytes, hard-linked: %s",
+                       sameFS, savings, linked)
+}
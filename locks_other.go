@@ -0,0 +1,13 @@
+//go:build !unix && !windows || aix || hurd || illumos || solaris
+
+package main
+
+import "os"
+
+func locked(f *os.File) bool {
+    return false
+}
+
+func lockError(err error) bool {
+    return false
+}
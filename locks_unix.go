@@ -0,0 +1,32 @@
+//go:build unix && !(aix || hurd || illumos || solaris)
+
+package main
+
+import (
+    "os"
+    "syscall"
+)
+
+// Reports whether another process holds a lock on f that conflicts with
+// reading it: an exclusive flock(2) lock, or a POSIX write lock on any
+// part of it, as databases use.
+func locked(f *os.File) bool {
+    fd := int(f.Fd())
+    lk := syscall.Flock_t{Type: syscall.F_RDLCK}
+    if syscall.FcntlFlock(f.Fd(), syscall.F_GETLK, &lk) == nil &&
+       lk.Type != syscall.F_UNLCK {
+        return true
+    }
+    if err := syscall.Flock(fd, syscall.LOCK_SH | syscall.LOCK_NB);
+       err != nil {
+        return err == syscall.EWOULDBLOCK
+    }
+    syscall.Flock(fd, syscall.LOCK_UN)
+    return false
+}
+
+// Reports whether err means that a file is locked by another process.
+// Unix locks are advisory, so they never make reading fail.
+func lockError(err error) bool {
+    return false
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+    "os"
+    "syscall"
+)
+
+// Windows enforces locks: reading a locked file fails, so there's nothing
+// to check up front.
+func locked(f *os.File) bool {
+    return false
+}
+
+const (
+    errorSharingViolation syscall.Errno = 32
+    errorLockViolation    syscall.Errno = 33
+)
+
+// Reports whether err means that a file is locked by another process.
+func lockError(err error) bool {
+    if pe, ok := err.(*os.PathError); ok {
+        err = pe.Err
+    }
+    errno, ok := err.(syscall.Errno)
+    return ok && (errno == errorSharingViolation ||
+                  errno == errorLockViolation)
+}
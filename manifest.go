@@ -0,0 +1,47 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// A manifest lists the hashes of the groups found by a run, one per line
+// in hex, so a later run can tell which groups are new.
+
+func writeManifest(path string, groups []group) error {
+    f, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    w := bufio.NewWriter(f)
+    fmt.Fprintln(w, "# dupes manifest: hashes of duplicate groups")
+    for _, g := range groups {
+        fmt.Fprintln(w, g.id())
+    }
+    if err = w.Flush(); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// Returns the set of hashes in the manifest at path.
+func readManifest(path string) (map[string]bool, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    hashes := make(map[string]bool)
+    sc := bufio.NewScanner(f)
+    for sc.Scan() {
+        line := strings.TrimSpace(sc.Text())
+        if line != "" && !strings.HasPrefix(line, "#") {
+            hashes[line] = true
+        }
+    }
+    return hashes, sc.Err()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+    "bufio"
+    "os"
+    "strconv"
+    "strings"
+)
+
+// Returns the set of mount points, from /proc/self/mountinfo.
+func mountPoints() (map[string]bool, error) {
+    f, err := os.Open("/proc/self/mountinfo")
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    mounts := make(map[string]bool)
+    s := bufio.NewScanner(f)
+    for s.Scan() {
+        // The fifth field is the mount point, with spaces and other
+        // special characters escaped as \ooo.
+        fields := strings.Fields(s.Text())
+        if len(fields) >= 5 {
+            mounts[unescapeOctal(fields[4])] = true
+        }
+    }
+    return mounts, s.Err()
+}
+
+func unescapeOctal(s string) string {
+    var b strings.Builder
+    for i := 0; i < len(s); i++ {
+        if s[i] == '\\' && i + 4 <= len(s) {
+            if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+                b.WriteByte(byte(c))
+                i += 3
+                continue
+            }
+        }
+        b.WriteByte(s[i])
+    }
+    return b.String()
+}
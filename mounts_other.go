@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// Mount points are only known on Linux; elsewhere, -skip-mounts does nothing.
+func mountPoints() (map[string]bool, error) {
+    return nil, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "path/filepath"
+    "sort"
+)
+
+// Files that share a base name but not their contents, for
+// -name-collisions: each version is a group of files with the same hash.
+type collision struct {
+    name     string
+    versions []group
+}
+
+// Find the base names in byhash shared by files with different hashes.
+// Versions are sorted by their first path, collisions by name.
+func nameCollisions(byhash map[string]group) (cols []collision) {
+    byname := make(map[string]map[string]group)
+    for h, g := range byhash {
+        for _, p := range g {
+            name := filepath.Base(p.path)
+            if byname[name] == nil {
+                byname[name] = make(map[string]group)
+            }
+            byname[name][h] = append(byname[name][h], p)
+        }
+    }
+
+    for name, versions := range byname {
+        if len(versions) < 2 {
+            continue
+        }
+        c := collision{name: name}
+        for _, g := range versions {
+            sort.Slice(g, func(i, j int) bool {
+                return g[i].path < g[j].path
+            })
+            c.versions = append(c.versions, g)
+        }
+        sort.Slice(c.versions, func(i, j int) bool {
+            return c.versions[i][0].path < c.versions[j][0].path
+        })
+        cols = append(cols, c)
+    }
+    sort.Slice(cols, func(i, j int) bool {
+        return cols[i].name < cols[j].name
+    })
+    return
+}
+
+// Write each collision as its name, followed by one tab-indented line per
+// version listing its paths, or, with showHash, its hash and paths.
+func writeCollisions(out io.Writer, cols []collision, showHash bool) error {
+    w := bufio.NewWriter(out)
+    for _, c := range cols {
+        fmt.Fprintln(w, c.name)
+        for _, g := range c.versions {
+            if showHash {
+                fmt.Fprintf(w, "\t%s %s\n", g.id(), g.quoted())
+            } else {
+                fmt.Fprintf(w, "\t%s\n", g.quoted())
+            }
+        }
+    }
+    return w.Flush()
+}
+
+// A collision as represented in JSON output.
+type jsonCollision struct {
+    Name     string  `json:"name"`
+    Versions []Group `json:"versions"`
+}
+
+// Write one JSON object per collision, each on its own line.
+func writeCollisionsJSONL(out io.Writer, cols []collision) error {
+    w := bufio.NewWriter(out)
+    enc := json.NewEncoder(w)
+    for _, c := range cols {
+        rec := jsonCollision{Name: c.name}
+        for _, g := range c.versions {
+            rec.Versions = append(rec.Versions, g.Group())
+        }
+        if err := enc.Encode(rec); err != nil {
+            return err
+        }
+    }
+    return w.Flush()
+}
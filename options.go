@@ -0,0 +1,233 @@
+package main
+
+import (
+    "path/filepath"
+    "regexp"
+    "runtime"
+)
+
+// Options controlling what a scan looks at and how it hashes. Every
+// command line flag that affects the scan itself, rather than how its
+// results are reported, corresponds to an Option that sets one of these.
+type Options struct {
+    Archives       bool              // also hash entries of tar and zip files
+    Cache          *hashCache        // hashes from earlier runs, or nil
+    Exclude        *regexp.Regexp    // skip paths matching this
+    ExcludeDirs    []glob            // prune directories matching any
+    ExcludeGlobs   []glob            // skip paths matching any of these
+    ExcludeSizes   map[int64]bool    // skip files of these sizes
+    FollowSymlinks string            // one of followPolicies
+    HashCmd        []string          // see runHashCmd; nil: hash contents
+    IgnoreEOL      bool              // see ignoresEOL
+    EOLLimit       int64             // largest file for IgnoreEOL
+    IgnoreLoops    bool              // symlink loops only get a warning
+    Include        *regexp.Regexp    // if set, only check paths matching this
+    IncludeGlobs   []glob            // if set, only check paths matching one
+    Jobs           int               // files to hash in parallel
+    MaxFiles       int               // stop after this many files; 0: no cap
+    MaxReadRate    int64             // bytes per second; 0: no limit
+    MaxSize        int64             // skip larger files; 0: no limit
+    MemBudget      int64             // see memBudget; 0: no limit
+    MinSize        int64             // skip smaller files
+    NormalizeText  bool              // see isNormalized
+    ProbeFirst     bool              // see probe
+    Queue          int               // files the walk may run ahead of hashing
+    Retries        int               // times to resume after a read error
+    Sample         float64           // fraction of files to check
+    SkipHeader     int64             // bytes at the start of files to ignore
+    SkipLocked     bool              // see locked and lockError
+    SkipMounts     map[string]bool   // absolute paths of mount points to prune
+    SkipPaths      map[string]bool   // absolute paths of files never to check
+    SkipSparse     bool
+
+    limiter        *rateLimiter      // enforces MaxReadRate
+}
+
+// An Option modifies Options.
+type Option func(*Options)
+
+// The Options of a scan when no flags are given.
+func DefaultOptions() *Options {
+    return &Options{EOLLimit: 1 << 20, FollowSymlinks: "none",
+                    IgnoreLoops: true, Jobs: runtime.GOMAXPROCS(0),
+                    Queue: 10, Sample: 1}
+}
+
+// Returns DefaultOptions modified by each of opts in turn.
+func NewOptions(opts ...Option) *Options {
+    o := DefaultOptions()
+    for _, opt := range opts {
+        opt(o)
+    }
+    return o
+}
+
+func WithArchives(on bool) Option {
+    return func(o *Options) { o.Archives = on }
+}
+
+// Look up and store hashes in c, unless it's nil.
+func WithCache(c *hashCache) Option {
+    return func(o *Options) { o.Cache = c }
+}
+
+// Skip files whose path matches re, unless it's nil.
+func WithExclude(re *regexp.Regexp) Option {
+    return func(o *Options) { o.Exclude = re }
+}
+
+// Don't walk directories whose path matches any of globs.
+func WithExcludeDirs(globs ...glob) Option {
+    return func(o *Options) {
+        o.ExcludeDirs = append(o.ExcludeDirs, globs...)
+    }
+}
+
+// Skip files whose path matches any of globs.
+func WithExcludeGlobs(globs ...glob) Option {
+    return func(o *Options) {
+        o.ExcludeGlobs = append(o.ExcludeGlobs, globs...)
+    }
+}
+
+// Skip files of any of the given sizes.
+func WithExcludeSizes(sizes ...int64) Option {
+    return func(o *Options) {
+        if o.ExcludeSizes == nil {
+            o.ExcludeSizes = make(map[int64]bool)
+        }
+        for _, size := range sizes {
+            o.ExcludeSizes[size] = true
+        }
+    }
+}
+
+var followPolicies = []string{"none", "all", "external-only"}
+
+// Follow symlinks according to policy: "none" (the default), "all",
+// or "external-only" to follow only those pointing outside all roots.
+func WithFollowSymlinks(policy string) Option {
+    return func(o *Options) { o.FollowSymlinks = policy }
+}
+
+// Hash the output of the command cmd, if not empty, for each file
+// instead of the file itself.
+func WithHashCmd(cmd []string) Option {
+    return func(o *Options) {
+        if len(cmd) > 0 {
+            o.HashCmd = cmd
+        }
+    }
+}
+
+// With on, ignore the difference between CRLF and LF line endings in
+// source files of up to limit bytes.
+func WithIgnoreEOL(on bool, limit int64) Option {
+    return func(o *Options) { o.IgnoreEOL, o.EOLLimit = on, limit }
+}
+
+// When following symlinks, a directory that has already been walked is
+// skipped. With on, that's reported as a warning; otherwise, as
+// an error that makes the exit status 1.
+func WithIgnoreLoops(on bool) Option {
+    return func(o *Options) { o.IgnoreLoops = on }
+}
+
+// Only check files whose path matches re, unless it's nil.
+func WithInclude(re *regexp.Regexp) Option {
+    return func(o *Options) { o.Include = re }
+}
+
+// Only check files whose path matches one of globs, if any are given.
+func WithIncludeGlobs(globs ...glob) Option {
+    return func(o *Options) {
+        o.IncludeGlobs = append(o.IncludeGlobs, globs...)
+    }
+}
+
+func WithJobs(n int) Option {
+    return func(o *Options) { o.Jobs = n }
+}
+
+func WithMaxFiles(n int) Option {
+    return func(o *Options) { o.MaxFiles = n }
+}
+
+// Read files at no more than rate bytes per second, in total.
+func WithMaxReadRate(rate int64) Option {
+    return func(o *Options) {
+        o.MaxReadRate = rate
+        if rate > 0 {
+            o.limiter = newRateLimiter(rate)
+        }
+    }
+}
+
+// Skip files larger than size bytes, unless size is zero.
+func WithMaxSize(size int64) Option {
+    return func(o *Options) { o.MaxSize = size }
+}
+
+// Save memory once the map of hashes takes up about limit bytes.
+func WithMemBudget(limit int64) Option {
+    return func(o *Options) { o.MemBudget = limit }
+}
+
+// Skip files smaller than size bytes.
+func WithMinSize(size int64) Option {
+    return func(o *Options) { o.MinSize = size }
+}
+
+func WithNormalizeText(on bool) Option {
+    return func(o *Options) { o.NormalizeText = on }
+}
+
+func WithProbeFirstBlock(on bool) Option {
+    return func(o *Options) { o.ProbeFirst = on }
+}
+
+func WithQueue(n int) Option {
+    return func(o *Options) { o.Queue = n }
+}
+
+func WithRetries(n int) Option {
+    return func(o *Options) { o.Retries = n }
+}
+
+func WithSample(rate float64) Option {
+    return func(o *Options) { o.Sample = rate }
+}
+
+// Hash files without their first n bytes, so that files that only differ
+// in a header of that size are duplicates.
+func WithSkipHeader(n int64) Option {
+    return func(o *Options) { o.SkipHeader = n }
+}
+
+func WithSkipLocked(on bool) Option {
+    return func(o *Options) { o.SkipLocked = on }
+}
+
+// Prune the walk at the given mount points, which must be absolute paths.
+func WithSkipMounts(mounts map[string]bool) Option {
+    return func(o *Options) { o.SkipMounts = mounts }
+}
+
+// Never check the files at paths, such as the ones dupes writes its
+// results to, so that a scan doesn't find its own output.
+func WithSkipPaths(paths ...string) Option {
+    return func(o *Options) {
+        if o.SkipPaths == nil {
+            o.SkipPaths = make(map[string]bool)
+        }
+        for _, path := range paths {
+            if abs, err := filepath.Abs(path); err == nil {
+                o.SkipPaths[abs] = true
+            }
+        }
+    }
+}
+
+func WithSkipSparse(on bool) Option {
+    return func(o *Options) { o.SkipSparse = on }
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+    "bufio"
+    "crypto/hmac"
+    "crypto/sha1"
+    "encoding/csv"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "text/template"
+    "time"
+    "unicode"
+)
+
+// Replace the hash of every file in groups by its HMAC with salt as the
+// key, so reports can be shared without revealing content fingerprints.
+// Files get the same hash as before if and only if they did before.
+func saltGroups(groups []group, salt string) {
+    for _, g := range groups {
+        mac := hmac.New(sha1.New, []byte(salt))
+        mac.Write([]byte(g[0].hash))
+        h := string(mac.Sum(nil))
+        for i := range g {
+            g[i].hash = h
+        }
+    }
+}
+
+// Keep only the groups for which keep is true.
+func filterGroups(groups []group, keep func(group) bool) []group {
+    var kept []group
+    for _, g := range groups {
+        if keep(g) {
+            kept = append(kept, g)
+        }
+    }
+    return kept
+}
+
+// Replace each path in groups with the one it resolves to, without
+// symlinks. Paths that turn out to be the same file are reported once,
+// and groups that are left with a single file are dropped. For an archive
+// entry, the archive's path is resolved.
+func resolveGroups(groups []group) []group {
+    var resolved []group
+    for _, g := range groups {
+        seen := make(map[string]bool)
+        var r group
+        for _, p := range g {
+            file := p.path
+            if p.inArchive() {
+                file = p.archive
+            }
+            real, err := filepath.EvalSymlinks(file)
+            if err != nil {
+                real = file     // reported as found
+            }
+            if p.inArchive() {
+                entry := strings.TrimPrefix(p.path, p.archive)
+                p.archive, real = real, real + entry
+            }
+            if !seen[real] {
+                seen[real] = true
+                p.path = real
+                r = append(r, p)
+            }
+        }
+        if len(r) > 1 {
+            sort.Slice(r, func(i, j int) bool { return r[i].path < r[j].path })
+            resolved = append(resolved, r)
+        }
+    }
+    sort.Slice(resolved, func(i, j int) bool {
+        return resolved[i][0].path < resolved[j][0].path
+    })
+    return resolved
+}
+
+// Split each group into groups of files with the same permission bits,
+// dropping files whose mode no other file shares. Groups that are split
+// are reported on stderr, since in a restored backup they point to modes
+// that weren't preserved.
+func splitByMode(groups []group) []group {
+    var split []group
+    for _, g := range groups {
+        var modes []os.FileMode
+        bymode := make(map[os.FileMode]group)
+        for _, p := range g {
+            m := p.info.Mode().Perm()
+            if bymode[m] == nil {
+                modes = append(modes, m)
+            }
+            bymode[m] = append(bymode[m], p)
+        }
+        if len(modes) > 1 {
+            desc := make([]string, len(modes))
+            for i, m := range modes {
+                desc[i] = fmt.Sprintf("%s (%s)", bymode[m][0].path, m)
+            }
+            fmt.Fprintf(os.Stderr, "%s: identical contents but different"+
+                        " modes: %s\n", os.Args[0], strings.Join(desc, ", "))
+        }
+        for _, m := range modes {
+            if len(bymode[m]) > 1 {
+                split = append(split, bymode[m])
+            }
+        }
+    }
+    sort.SliceStable(split, func(i, j int) bool {
+        return split[i][0].path < split[j][0].path
+    })
+    return split
+}
+
+// Reports whether g has files from more than one root.
+func spansRoots(g group) bool {
+    for _, p := range g[1:] {
+        if p.root != g[0].root {
+            return true
+        }
+    }
+    return false
+}
+
+// Reports whether g has a file found under root.
+func underRoot(g group, root string) bool {
+    for _, p := range g {
+        if p.root == root {
+            return true
+        }
+    }
+    return false
+}
+
+// Reports whether g has files on more than one file system, as told by
+// their device numbers. Archive entries count for the device of their
+// archive; files without a device number, as on Windows, for none.
+func spansDevices(g group) bool {
+    devs := make(map[uint64]bool)
+    for _, p := range g {
+        info := p.info
+        if p.inArchive() {
+            info, _ = os.Stat(p.archive)
+        }
+        if info == nil {
+            continue
+        }
+        if dev, _, ok := devIno(info); ok {
+            devs[dev] = true
+        }
+    }
+    return len(devs) > 1
+}
+
+// Put the paths in g that are under root before the others, keeping
+// their order otherwise. With -diff, this puts the first root's files
+// on the left.
+func sortBySide(g group, root string) {
+    sort.SliceStable(g, func(i, j int) bool {
+        return g[i].root == root && g[j].root != root
+    })
+}
+
+// Put the paths in g that are under the -compare-against baseline after
+// the others, keeping their order otherwise.
+func baselineLast(g group, baseline string) {
+    sort.SliceStable(g, func(i, j int) bool {
+        return g[i].root != baseline && g[j].root == baseline
+    })
+}
+
+var groupOrders = []string{"path", "mtime-asc", "mtime-desc", "depth"}
+
+// Reorder the paths within g, which must be sorted by path, according to
+// the -group-order. Ties keep their order by path.
+func orderGroup(g group, order string) {
+    var less func(a, b pathInfo) bool
+    switch order {
+    case "mtime-asc":
+        less = func(a, b pathInfo) bool {
+            return a.info.ModTime().Before(b.info.ModTime())
+        }
+    case "mtime-desc":
+        less = func(a, b pathInfo) bool {
+            return a.info.ModTime().After(b.info.ModTime())
+        }
+    case "depth":
+        less = func(a, b pathInfo) bool {
+            return depth(a.path) < depth(b.path)
+        }
+    default:
+        return
+    }
+    sort.SliceStable(g, func(i, j int) bool { return less(g[i], g[j]) })
+}
+
+// Number of directories above path.
+func depth(path string) int {
+    return strings.Count(path, string(os.PathSeparator))
+}
+
+// Options for text output.
+type textStyle struct {
+    print0     bool     // NUL-terminate paths and groups
+    showHash   bool     // print the group id first
+    linkReport bool     // follow each group with its linkDetails
+    count      *jsonCount   // if set, printed in an ending comment line
+    tmpl       *template.Template   // if set, executed for each group
+    explain    func(group) *explanation // if set, annotates each group
+}
+
+func writeText(out io.Writer, groups []group, style textStyle) error {
+    w := bufio.NewWriter(out)
+    for _, g := range groups {
+        switch {
+        case style.tmpl != nil:
+            if err := style.tmpl.Execute(w, g.Group().record()); err != nil {
+                return err
+            }
+            fmt.Fprintln(w)
+        case style.print0:
+            for _, p := range g {
+                fmt.Fprint(w, p.path, "\x00")
+            }
+            fmt.Fprint(w, "\x00")
+        case style.showHash:
+            fmt.Fprintln(w, g.id(), g.quoted())
+        default:
+            fmt.Fprintln(w, g.quoted())
+        }
+        if style.linkReport {
+            fmt.Fprintf(w, "\t%s\n", linkDetails(g))
+        }
+        if style.explain != nil {
+            fmt.Fprintf(w, "\t%s\n", style.explain(g))
+        }
+    }
+    if c := style.count; c != nil {
+        fmt.Fprintf(w, "# %d duplicate groups, %d redundant files\n",
+                    c.Groups, c.Redundant)
+    }
+    return w.Flush()
+}
+
+// The paths of g, separated by spaces, with those that contain spaces or
+// other characters that would make that ambiguous quoted as Go strings.
+func (g group) quoted() string {
+    paths := g.paths()
+    for i, p := range paths {
+        paths[i] = quotePath(p)
+    }
+    return strings.Join(paths, " ")
+}
+
+// Returns path, quoted as a Go string if needsQuote holds for any of it.
+func quotePath(path string) string {
+    if strings.IndexFunc(path, needsQuote) >= 0 {
+        return strconv.Quote(path)
+    }
+    return path
+}
+
+func needsQuote(r rune) bool {
+    return r == '"' || r == '\\' || unicode.IsSpace(r) || !unicode.IsPrint(r)
+}
+
+// Number of files that could be removed, keeping one of each group, with
+// hard links counted as the -hardlinks policy says.
+func redundant(groups []group, hardlinks string) (n int) {
+    for _, g := range groups {
+        n += copies(g, hardlinks) - 1
+    }
+    return
+}
+
+// A group of duplicates: the files at Paths all have Size bytes and hash
+// to Hash. Explain and Files are set for -explain and -times. All output
+// formats but text encode this type.
+type Group struct {
+    Hash    []byte
+    Size    int64
+    Paths   []string
+    Explain *explanation
+    Files   []jsonFile      // in the order of Paths
+
+    ordered bool    // Paths are in the order chosen by -group-order
+}
+
+func (g group) Group() Group {
+    return Group{Hash: []byte(g[0].hash), Size: g[0].size, Paths: g.paths(),
+                 ordered: true}
+}
+
+// A Group as represented in JSON output, and as seen by -template.
+type jsonGroup struct {
+    Hash  string   `json:"hash"`
+    Size  int64    `json:"size"`
+    Paths []string `json:"paths"`
+
+    Explain *explanation `json:"explain,omitempty"`
+    Files   []jsonFile   `json:"files,omitempty"`     // with -times
+}
+
+// A file of a group with its times in RFC 3339 format, left out where
+// they're unknown, as for archive entries.
+type jsonFile struct {
+    Path  string `json:"path"`
+    Mtime string `json:"mtime,omitempty"`
+    Atime string `json:"atime,omitempty"`
+}
+
+// The files of g with their modification and access times.
+func fileTimes(g group) []jsonFile {
+    files := make([]jsonFile, len(g))
+    for i, p := range g {
+        files[i].Path = p.path
+        if p.inArchive() || p.info == nil {
+            continue
+        }
+        files[i].Mtime = p.info.ModTime().Format(time.RFC3339)
+        if at, ok := atime(p.info); ok {
+            files[i].Atime = at.Format(time.RFC3339)
+        }
+    }
+    return files
+}
+
+// The JSON representation of g. Its paths are sorted, unless they're in
+// the order chosen by -group-order.
+func (g Group) record() jsonGroup {
+    rec := jsonGroup{Hash: hex.EncodeToString(g.Hash), Size: g.Size,
+                     Paths: g.Paths, Explain: g.Explain, Files: g.Files}
+    if !g.ordered && !sort.StringsAreSorted(g.Paths) {
+        rec.Paths = append([]string(nil), g.Paths...)
+        sort.Strings(rec.Paths)
+        if g.Files != nil {
+            rec.Files = append([]jsonFile(nil), g.Files...)
+            sort.Slice(rec.Files, func(i, j int) bool {
+                return rec.Files[i].Path < rec.Files[j].Path
+            })
+        }
+    }
+    return rec
+}
+
+// Encodes g with its hash in hex, as in the json and jsonl formats.
+func (g Group) MarshalJSON() ([]byte, error) {
+    return json.Marshal(g.record())
+}
+
+// Write the paths of each group to a file of its own in dir, which is
+// created if needed, one path per line or, with print0, NUL-terminated.
+// Files are named by the group's hash; groups that share a hash (see
+// splitByMode) get a numeric suffix.
+func writeSplit(dir string, groups []group, print0 bool) error {
+    if err := os.MkdirAll(dir, 0777); err != nil {
+        return err
+    }
+    term := "\n"
+    if print0 {
+        term = "\x00"
+    }
+    seen := make(map[string]int)
+    for _, g := range groups {
+        name := g.id()
+        if seen[name]++; seen[name] > 1 {
+            name = fmt.Sprintf("%s-%d", name, seen[name])
+        }
+        var b strings.Builder
+        for _, p := range g {
+            b.WriteString(p.path + term)
+        }
+        path := filepath.Join(dir, name)
+        if err := os.WriteFile(path, []byte(b.String()), 0666); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// g as a Group, with the fields that explain and times ask for.
+func outputGroup(g group, explain func(group) *explanation,
+                 times bool) Group {
+    out := g.Group()
+    if explain != nil {
+        out.Explain = explain(g)
+    }
+    if times {
+        out.Files = fileTimes(g)
+    }
+    return out
+}
+
+// Write the groups as a single JSON array, with the same objects as
+// writeJSONL. If count is set, the array is instead the "groups" field of
+// an object whose "count" field is count.
+func writeJSON(out io.Writer, groups []group, count *jsonCount,
+               explain func(group) *explanation, times bool) error {
+    all := make([]Group, len(groups))
+    for i, g := range groups {
+        all[i] = outputGroup(g, explain, times)
+    }
+    var v any = all
+    if count != nil {
+        v = struct {
+            Groups []Group    `json:"groups"`
+            Count  *jsonCount `json:"count"`
+        }{all, count}
+    }
+    b, err := json.MarshalIndent(v, "", "  ")
+    if err != nil {
+        return err
+    }
+    _, err = fmt.Fprintf(out, "%s\n", b)
+    return err
+}
+
+// Write a CSV table with a row for each file: its group's hash, its size
+// and its path and, with times, its modification and access times.
+func writeCSV(out io.Writer, groups []group, times bool) error {
+    w := csv.NewWriter(out)
+    header := []string{"hash", "size", "path"}
+    if times {
+        header = append(header, "mtime", "atime")
+    }
+    w.Write(header)
+    for _, g := range groups {
+        size := strconv.FormatInt(g[0].size, 10)
+        for _, f := range fileTimes(g) {
+            row := []string{g.id(), size, f.Path}
+            if times {
+                row = append(row, f.Mtime, f.Atime)
+            }
+            w.Write(row)
+        }
+    }
+    w.Flush()
+    return w.Error()
+}
+
+// The number of groups and redundant files for -count: the final line of
+// JSONL output, and the "count" field of JSON output.
+type jsonCount struct {
+    Groups    int `json:"groups"`
+    Redundant int `json:"redundant"`
+}
+
+// Write one JSON object per group, each on its own line. If count is set,
+// a final object has it as its "count" field. If explain is set, each
+// group gets an "explain" field; with times, a "files" field.
+func writeJSONL(out io.Writer, groups []group, count *jsonCount,
+                explain func(group) *explanation, times bool) error {
+    w := bufio.NewWriter(out)
+    enc := json.NewEncoder(w)
+    for _, g := range groups {
+        if err := enc.Encode(outputGroup(g, explain, times)); err != nil {
+            return err
+        }
+    }
+    if count != nil {
+        c := map[string]*jsonCount{"count": count}
+        if err := enc.Encode(c); err != nil {
+            return err
+        }
+    }
+    return w.Flush()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+    "io"
+    "os"
+)
+
+// Bytes read from the start of each file by -probe-first-block.
+const probeSize = 512
+
+// Pass on from in to out only the files that may have duplicates: those
+// that share their size with another file and, with o.ProbeFirst, their
+// first probeSize bytes, too. Most files in a large tree have a size of
+// their own, so this saves hashing them, and probing takes one small
+// read per file. Files that bySize rules out are counted as done for
+// the progress report. Needs to see all files before passing any on.
+func candidates(in <-chan pathInfo, out chan<- pathInfo, o *Options) {
+    bysize := make(map[int64][]pathInfo)
+    for p := range in {
+        if o.bySize(p.path, p.size) {
+            bysize[p.size] = append(bysize[p.size], p)
+        } else {
+            out <- p
+        }
+    }
+
+    for _, same := range bysize {
+        switch {
+        case len(same) < 2:
+            prog.addSkipped(len(same))
+            continue
+        case !o.ProbeFirst:
+            for _, p := range same {
+                out <- p
+            }
+            continue
+        }
+        byblock := make(map[string][]pathInfo)
+        for _, p := range same {
+            block, err := firstBlock(p.path, o)
+            if err != nil {
+                errors <- err
+                prog.addSkipped(1)
+                continue
+            }
+            byblock[block] = append(byblock[block], p)
+        }
+        for _, g := range byblock {
+            if len(g) < 2 {
+                prog.addSkipped(len(g))
+                continue
+            }
+            for _, p := range g {
+                out <- p
+            }
+        }
+    }
+    close(out)
+}
+
+// Reports whether the file at path, of the given size, can only have
+// duplicates of the same size, so that candidates may leave it out if
+// it has a size of its own. It can't be when it's hashed by o.HashCmd
+// or normalized, nor with o.Archives, since any file may match an entry
+// of an archive, which isn't known until the archive is read.
+func (o *Options) bySize(path string, size int64) bool {
+    return !o.Archives && o.HashCmd == nil && o.normalizer(path, size) == nil
+}
+
+// Read the first probeSize bytes after the header of the file at path, or
+// all of it if it's shorter.
+func firstBlock(path string, o *Options) (string, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+
+    if _, err = f.Seek(o.SkipHeader, io.SeekStart); err != nil {
+        return "", err
+    }
+    buf := make([]byte, probeSize)
+    n, err := io.ReadFull(o.limiter.reader(f), buf)
+    if err == io.EOF || err == io.ErrUnexpectedEOF {
+        err = nil
+    }
+    return string(buf[:n]), err
+}
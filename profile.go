@@ -0,0 +1,42 @@
+package main
+
+import (
+    "os"
+    "runtime"
+    "runtime/pprof"
+)
+
+// Start writing a CPU profile to path, for -cpuprofile. Returns the
+// function that stops profiling and closes the file; a no-op if path is
+// empty.
+func startCPUProfile(path string) (stop func(), err error) {
+    if path == "" {
+        return func() {}, nil
+    }
+    f, err := os.Create(path)
+    if err != nil {
+        return nil, err
+    }
+    if err = pprof.StartCPUProfile(f); err != nil {
+        f.Close()
+        return nil, err
+    }
+    return func() {
+        pprof.StopCPUProfile()
+        f.Close()
+    }, nil
+}
+
+// Write a heap profile to path, for -memprofile.
+func writeMemProfile(path string) error {
+    f, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    runtime.GC()    // so the profile is up to date
+    if err = pprof.WriteHeapProfile(f); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
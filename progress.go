@@ -0,0 +1,110 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "sync/atomic"
+    "time"
+)
+
+// Progress reporting on stderr. On a terminal, a single status line is
+// redrawn in place; otherwise (stderr redirected to a file or pipe), a
+// plain line is written every few seconds so logs stay readable.
+type progress struct {
+    found   atomic.Int64    // files queued by the walker
+    hashed  atomic.Int64    // files processed by the hasher
+    skipped atomic.Int64    // files found not to need hashing
+    bytes   atomic.Int64    // bytes read by the hasher
+    tty     bool
+    done    chan empty
+    stopped chan empty
+}
+
+var spinner = []byte{'|', '/', '-', '\\'}
+
+func newProgress() *progress {
+    return &progress{
+        tty:     isTerminal(os.Stderr),
+        done:    make(chan empty),
+        stopped: make(chan empty),
+    }
+}
+
+// Reports whether f refers to a terminal.
+func isTerminal(f *os.File) bool {
+    info, err := f.Stat()
+    return err == nil && info.Mode() & os.ModeCharDevice != 0
+}
+
+// The add methods are no-ops on a nil *progress, so callers need not
+// check whether progress reporting is enabled.
+func (p *progress) addFound() {
+    if p != nil {
+        p.found.Add(1)
+    }
+}
+
+// Count a file as processed, n bytes of which were read.
+func (p *progress) addHashed(n int64) {
+    if p != nil {
+        p.hashed.Add(1)
+        p.bytes.Add(n)
+    }
+}
+
+// Count n files as done without hashing them.
+func (p *progress) addSkipped(n int) {
+    if p != nil {
+        p.skipped.Add(int64(n))
+    }
+}
+
+func (p *progress) run() {
+    interval := 5 * time.Second
+    if p.tty {
+        interval = 100 * time.Millisecond
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for i := 0; ; i++ {
+        select {
+        case <-p.done:
+            p.report(-1)
+            close(p.stopped)
+            return
+        case <-ticker.C:
+            p.report(i)
+        }
+    }
+}
+
+// Stop the reporter and wait for it to print its final line.
+func (p *progress) stop() {
+    if p != nil {
+        close(p.done)
+        <-p.stopped
+    }
+}
+
+// Print a status line. tick < 0 means this is the final report.
+func (p *progress) report(tick int) {
+    found, hashed := p.found.Load(), p.hashed.Load()
+    done := hashed + p.skipped.Load()
+    pct := 100.
+    if found > 0 {
+        pct = 100 * float64(done) / float64(found)
+    }
+    msg := fmt.Sprintf("done with %d of %d files (%.1f%%), %d hashed,"+
+                       " %d bytes", done, found, pct, hashed, p.bytes.Load())
+
+    switch {
+    case !p.tty:
+        fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], msg)
+    case tick < 0:
+        fmt.Fprintf(os.Stderr, "\r%s\033[K\n", msg)
+    default:
+        fmt.Fprintf(os.Stderr, "\r%c %s\033[K",
+                    spinner[tick % len(spinner)], msg)
+    }
+}
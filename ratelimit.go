@@ -0,0 +1,63 @@
+package main
+
+import (
+    "io"
+    "sync"
+    "time"
+)
+
+// A token bucket limiting the rate at which files are read, shared by
+// everything that reads them, so that the limit holds for the scan as a
+// whole. Reading more than the bucket holds puts it in debt, which later
+// readers wait out.
+type rateLimiter struct {
+    mu     sync.Mutex
+    rate   float64     // bytes per second
+    tokens float64     // at most rate: bursts last a second at most
+    last   time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+    return &rateLimiter{rate: float64(rate), tokens: float64(rate),
+                        last: time.Now()}
+}
+
+// Take n bytes from the bucket, sleeping if there aren't enough.
+func (l *rateLimiter) take(n int) {
+    l.mu.Lock()
+    now := time.Now()
+    l.tokens += now.Sub(l.last).Seconds() * l.rate
+    if l.tokens > l.rate {
+        l.tokens = l.rate
+    }
+    l.last = now
+    l.tokens -= float64(n)
+    debt := -l.tokens
+    l.mu.Unlock()
+
+    if debt > 0 {
+        time.Sleep(time.Duration(debt / l.rate * float64(time.Second)))
+    }
+}
+
+// Returns r, throttled by l. A nil *rateLimiter returns r itself.
+func (l *rateLimiter) reader(r io.Reader) io.Reader {
+    if l == nil {
+        return r
+    }
+    return &limitedReader{r, l}
+}
+
+type limitedReader struct {
+    r io.Reader
+    l *rateLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+    if max := int(lr.l.rate); len(p) > max && max > 0 {
+        p = p[:max]
+    }
+    n, err := lr.r.Read(p)
+    lr.l.take(n)
+    return n, err
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+var errNoReflink = fmt.Errorf("file system doesn't support reflinks")
+
+// Make the file at dst share the blocks of src, on file systems that
+// support that, such as Btrfs and XFS. Unlike hard links, the files stay
+// separate, with their own metadata, but only one copy takes up space.
+func reflink(dst, src string) error {
+    in, err := os.Open(src)
+    if err != nil {
+        return err
+    }
+    defer in.Close()
+    out, err := os.OpenFile(dst, os.O_WRONLY, 0)
+    if err != nil {
+        return err
+    }
+    defer out.Close()
+
+    if err = clone(out, in); err != nil && err != errNoReflink {
+        err = &os.PathError{Op: "reflink", Path: dst, Err: err}
+    }
+    return err
+}
+
+func sameDevice(a, b pathInfo) bool {
+    if a.info == nil || b.info == nil {
+        return false
+    }
+    da, _, ok := devIno(a.info)
+    db, _, _ := devIno(b.info)
+    return ok && da == db
+}
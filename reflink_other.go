@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+func clone(dst, src *os.File) error {
+    return errNoReflink
+}
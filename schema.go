@@ -0,0 +1,101 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "reflect"
+    "sort"
+    "strings"
+)
+
+// Write a JSON Schema for -json-schema to out, which a line of -format
+// jsonl output and the whole of -format json output both match. It's
+// derived from the types that output is encoded from, so the two can't
+// drift apart.
+func writeSchema(out io.Writer) error {
+    group := map[string]any{"$ref": "#/$defs/group"}
+    count := map[string]any{"$ref": "#/$defs/count"}
+    schema := map[string]any{
+        "$schema":     "https://json-schema.org/draft/2020-12/schema",
+        "title":       "dupes -format jsonl and json",
+        "description": "With jsonl, one line of output: a group of" +
+                       " duplicates, the final count for -count or a" +
+                       " name for -name-collisions. With json, all of" +
+                       " it: an array of groups or, with -count, an" +
+                       " object with the groups and the count.",
+        "$defs": map[string]any{
+            "group":     typeSchema(reflect.TypeOf(jsonGroup{})),
+            "count":     typeSchema(reflect.TypeOf(jsonCount{})),
+            "collision": typeSchema(reflect.TypeOf(jsonCollision{})),
+        },
+        "oneOf": []any{
+            group,
+            object(map[string]any{"count": count}),
+            map[string]any{"$ref": "#/$defs/collision"},
+            map[string]any{"type": "array", "items": group},
+            object(map[string]any{
+                "groups": map[string]any{"type": "array", "items": group},
+                "count":  count,
+            }),
+        },
+    }
+    b, err := json.MarshalIndent(schema, "", "  ")
+    if err != nil {
+        return err
+    }
+    _, err = fmt.Fprintf(out, "%s\n", b)
+    return err
+}
+
+// The schema of an object with all of props, and nothing else.
+func object(props map[string]any) map[string]any {
+    required := []string{}
+    for name := range props {
+        required = append(required, name)
+    }
+    sort.Strings(required)
+    return map[string]any{"type": "object", "properties": props,
+                          "required": required,
+                          "additionalProperties": false}
+}
+
+// The schema of the JSON encoding of values of type t, as far as the
+// types used in the output need.
+func typeSchema(t reflect.Type) map[string]any {
+    if t == reflect.TypeOf(Group{}) {
+        return map[string]any{"$ref": "#/$defs/group"}  // see MarshalJSON
+    }
+    switch t.Kind() {
+    case reflect.Pointer:
+        return typeSchema(t.Elem())
+    case reflect.Bool:
+        return map[string]any{"type": "boolean"}
+    case reflect.Int, reflect.Int64:
+        return map[string]any{"type": "integer"}
+    case reflect.Float64:
+        return map[string]any{"type": "number"}
+    case reflect.String:
+        return map[string]any{"type": "string"}
+    case reflect.Slice:
+        return map[string]any{"type": "array",
+                              "items": typeSchema(t.Elem())}
+    case reflect.Struct:
+        props := make(map[string]any)
+        required := []string{}
+        for i := 0; i < t.NumField(); i++ {
+            tag := strings.Split(t.Field(i).Tag.Get("json"), ",")
+            if tag[0] == "" || tag[0] == "-" {
+                continue
+            }
+            props[tag[0]] = typeSchema(t.Field(i).Type)
+            if len(tag) < 2 || tag[1] != "omitempty" {
+                required = append(required, tag[0])
+            }
+        }
+        return map[string]any{"type": "object", "properties": props,
+                              "required": required,
+                              "additionalProperties": false}
+    }
+    panic("no JSON schema for " + t.String())
+}
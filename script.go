@@ -0,0 +1,145 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "runtime"
+    "strings"
+    "time"
+)
+
+var keepPolicies = []string{"first", "shortest", "oldest", "newest"}
+
+// Returns the index in g of the file to keep under the given policy:
+// the lexicographically smallest path for "first", the shortest path for
+// "shortest", or the file modified longest ago or most recently for
+// "oldest" and "newest", ties broken as for "first". This doesn't depend
+// on the order of g, so the same file is kept on every run. Files outside
+// archives are preferred, since archive entries can't be linked to.
+func keeper(g group, policy string) int {
+    k := 0
+    for i, p := range g {
+        if p.inArchive() != g[k].inArchive() {
+            if !p.inArchive() {
+                k = i
+            }
+            continue
+        }
+        if preferred(p, g[k], policy) {
+            k = i
+        }
+    }
+    return k
+}
+
+// Reports whether policy prefers keeping p over q.
+func preferred(p, q pathInfo, policy string) bool {
+    switch policy {
+    case "shortest":
+        if len(p.path) != len(q.path) {
+            return len(p.path) < len(q.path)
+        }
+    case "oldest", "newest":
+        if tp, tq := modTime(p), modTime(q); !tp.Equal(tq) {
+            return tp.Before(tq) == (policy == "oldest")
+        }
+    }
+    return p.path < q.path
+}
+
+func modTime(p pathInfo) time.Time {
+    if p.info == nil {
+        return time.Time{}
+    }
+    return p.info.ModTime()
+}
+
+// Reports whether all files of g outside archives have the same owner,
+// as far as the platform tells. If not, removing all but one of them
+// could destroy another user's data, so g is reported on stderr.
+func sameOwner(g group) bool {
+    uids := make(map[uint32]bool)
+    for _, p := range g {
+        if p.inArchive() || p.info == nil {
+            continue
+        }
+        if uid, ok := owner(p.info); ok {
+            uids[uid] = true
+        }
+    }
+    if len(uids) > 1 {
+        fmt.Fprintf(os.Stderr, "%s: skipping group of %s: files have"+
+                    " different owners (-allow-cross-user)\n",
+                    os.Args[0], g[0].path)
+        return false
+    }
+    return true
+}
+
+// Write a script to path that removes (or, if link is set, hard-links to
+// the kept copy) all but one file of each group. Archive entries are
+// only mentioned in comments. Nothing is done to the files themselves;
+// the script is meant to be reviewed and run by hand.
+// On Windows, a PowerShell script is written, elsewhere a POSIX shell one.
+func genScript(path string, groups []group, policy string,
+               link bool) error {
+    f, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    w := bufio.NewWriter(f)
+
+    windows := runtime.GOOS == "windows"
+    quote := shQuote
+    if windows {
+        quote = psQuote
+    } else {
+        fmt.Fprintln(w, "#!/bin/sh")
+    }
+    fmt.Fprintln(w, "# Generated by dupes. Review before running.")
+
+    for _, g := range groups {
+        k := keeper(g, policy)
+        if g[k].inArchive() {
+            continue    // nothing outside archives
+        }
+        keep := quote(g[k].path)
+        fmt.Fprintf(w, "\n# keep %s\n", keep)
+        for i := range g {
+            if i == k {
+                continue
+            }
+            p := quote(g[i].path)
+            switch {
+            case g[i].inArchive():
+                fmt.Fprintf(w, "# in archive: %s\n", p)
+            case windows && link:
+                fmt.Fprintf(w, "New-Item -ItemType HardLink -Force "+
+                               "-Path %s -Target %s\n", p, keep)
+            case windows:
+                fmt.Fprintf(w, "Remove-Item -LiteralPath %s\n", p)
+            case link:
+                fmt.Fprintf(w, "ln -f -- %s %s\n", keep, p)
+            default:
+                fmt.Fprintf(w, "rm -- %s\n", p)
+            }
+        }
+    }
+
+    if err = w.Flush(); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// Quote s for a POSIX shell.
+func shQuote(s string) string {
+    return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Quote s for PowerShell.
+func psQuote(s string) string {
+    return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+)
+
+// Files of the -self-test tree, and the groups a scan should find.
+var selfTestFiles = map[string]string{
+    "a/one":       "hello, world\n",
+    "b/two":       "hello, world\n",
+    "b/c/three":   "hello, world\n",
+    "same-size":   "hello, World\n",
+    "a/first":     "goodbye\n",
+    "b/second":    "goodbye\n",
+    "unique":      "nothing like it\n",
+    "a/empty":     "",
+    "b/c/empty":   "",
+}
+
+var selfTestGroups = [][]string{
+    {"a/empty", "b/c/empty"},
+    {"a/first", "b/second"},
+    {"a/one", "b/c/three", "b/two"},
+}
+
+// Create a small tree with known duplicates in a temporary directory,
+// scan it and compare the results to what they should be. Prints PASS or
+// FAIL and returns the exit code.
+func runSelfTest() int {
+    dir, err := os.MkdirTemp("", "dupes-self-test")
+    if err != nil {
+        fmt.Printf("FAIL: %s\n", err)
+        return 1
+    }
+    defer os.RemoveAll(dir)
+
+    for name, content := range selfTestFiles {
+        path := filepath.Join(dir, filepath.FromSlash(name))
+        err := os.MkdirAll(filepath.Dir(path), 0700)
+        if err == nil {
+            err = os.WriteFile(path, []byte(content), 0600)
+        }
+        if err != nil {
+            fmt.Printf("FAIL: %s\n", err)
+            return 1
+        }
+    }
+
+    // The test must not depend on options meant for a real scan.
+    o := DefaultOptions()
+    groups, exitcode := scan(func(paths chan<- pathInfo) int {
+        return walk([]string{dir}, paths, o)
+    }, o)
+
+    got := make([][]string, len(groups))
+    for i, g := range groups {
+        for _, p := range g.paths() {
+            rel, _ := filepath.Rel(dir, p)
+            got[i] = append(got[i], filepath.ToSlash(rel))
+        }
+    }
+
+    switch {
+    case exitcode != 0:
+        fmt.Printf("FAIL: walk exited with status %d\n", exitcode)
+    case !reflect.DeepEqual(got, selfTestGroups):
+        fmt.Printf("FAIL: expected groups\n%s\ngot\n%s\n",
+                   formatGroups(selfTestGroups), formatGroups(got))
+    default:
+        fmt.Println("PASS")
+        return 0
+    }
+    return 1
+}
+
+func formatGroups(groups [][]string) string {
+    lines := make([]string, len(groups))
+    for i, g := range groups {
+        lines[i] = "    " + strings.Join(g, " ")
+    }
+    return strings.Join(lines, "\n")
+}
@@ -0,0 +1,88 @@
+//go:build sqlite
+
+package main
+
+import (
+    "database/sql"
+    "time"
+
+    _ "modernc.org/sqlite"
+)
+
+const haveSQLite = true
+
+const sqliteTime = "2006-01-02 15:04:05"
+
+// Each run adds a row to scans and one row to files for every file in a
+// duplicate group. The groups view has a row per group and scan.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS scans (
+    id    INTEGER PRIMARY KEY,
+    time  TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS files (
+    scan  INTEGER NOT NULL REFERENCES scans(id),
+    path  TEXT NOT NULL,
+    size  INTEGER NOT NULL,
+    hash  TEXT NOT NULL,
+    mtime TEXT
+);
+CREATE INDEX IF NOT EXISTS files_hash ON files (hash);
+CREATE VIEW IF NOT EXISTS groups AS
+    SELECT files.scan, scans.time, hash, size, count(*) AS copies,
+           (count(*) - 1) * size AS reclaimable
+    FROM files JOIN scans ON scans.id = files.scan
+    GROUP BY files.scan, hash;
+`
+
+// Add groups to the SQLite database at path, creating it and its schema
+// if needed. Times are stored in UTC in the format of SQLite's datetime
+// function, so they compare correctly with its results.
+func writeSQLite(path string, groups []group) error {
+    db, err := sql.Open("sqlite", path)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+
+    if _, err := db.Exec(sqliteSchema); err != nil {
+        return err
+    }
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    now := time.Now().UTC().Format(sqliteTime)
+    res, err := tx.Exec("INSERT INTO scans (time) VALUES (?)", now)
+    if err != nil {
+        return err
+    }
+    scan, err := res.LastInsertId()
+    if err != nil {
+        return err
+    }
+
+    insert, err := tx.Prepare("INSERT INTO files" +
+                              " (scan, path, size, hash, mtime)" +
+                              " VALUES (?, ?, ?, ?, ?)")
+    if err != nil {
+        return err
+    }
+    defer insert.Close()
+    for _, g := range groups {
+        id := g.id()
+        for _, p := range g {
+            var mtime any
+            if p.info != nil {
+                mtime = p.info.ModTime().UTC().Format(sqliteTime)
+            }
+            _, err := insert.Exec(scan, p.path, p.size, id, mtime)
+            if err != nil {
+                return err
+            }
+        }
+    }
+    return tx.Commit()
+}
@@ -0,0 +1,13 @@
+//go:build !sqlite
+
+package main
+
+import "fmt"
+
+// SQLite support needs a driver that isn't in the standard library, so
+// it's only built with -tags sqlite.
+const haveSQLite = false
+
+func writeSQLite(path string, groups []group) error {
+    return fmt.Errorf("-sqlite: not supported by this build")
+}
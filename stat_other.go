@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func devIno(info os.FileInfo) (dev, ino uint64, ok bool) {
+    return 0, 0, false
+}
+
+func allocated(info os.FileInfo) (int64, bool) {
+    return 0, false
+}
+
+func owner(info os.FileInfo) (uint32, bool) {
+    return 0, false
+}
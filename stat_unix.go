@@ -0,0 +1,38 @@
+//go:build unix
+
+package main
+
+import (
+    "os"
+    "syscall"
+)
+
+// Returns the device and inode numbers of the file described by info,
+// if the platform provides them.
+func devIno(info os.FileInfo) (dev, ino uint64, ok bool) {
+    st, ok := info.Sys().(*syscall.Stat_t)
+    if !ok {
+        return 0, 0, false
+    }
+    return uint64(st.Dev), uint64(st.Ino), true
+}
+
+// Returns the number of bytes allocated on disk for the file that info
+// describes, if the platform provides it.
+func allocated(info os.FileInfo) (int64, bool) {
+    st, ok := info.Sys().(*syscall.Stat_t)
+    if !ok {
+        return 0, false
+    }
+    return int64(st.Blocks) * 512, true
+}
+
+// Returns the user id of the owner of the file that info describes, if
+// the platform provides it.
+func owner(info os.FileInfo) (uint32, bool) {
+    st, ok := info.Sys().(*syscall.Stat_t)
+    if !ok {
+        return 0, false
+    }
+    return st.Uid, true
+}
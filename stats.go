@@ -0,0 +1,112 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "text/tabwriter"
+)
+
+// Number of redundant files and the bytes they take up.
+type tally struct {
+    files int
+    bytes int64
+}
+
+// Tally the redundant files in groups, i.e., all but the first of each,
+// by the key that key returns for their path.
+func tallyBy(groups []group, key func(path string) string) map[string]*tally {
+    t := make(map[string]*tally)
+    for _, g := range groups {
+        for _, p := range g[1:] {
+            k := key(p.path)
+            if t[k] == nil {
+                t[k] = new(tally)
+            }
+            t[k].files++
+            t[k].bytes += p.size
+        }
+    }
+    return t
+}
+
+// Print t as a table on stderr, largest number of bytes first.
+func printTally(heading string, t map[string]*tally) {
+    keys := make([]string, 0, len(t))
+    for k := range t {
+        keys = append(keys, k)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        if t[keys[i]].bytes != t[keys[j]].bytes {
+            return t[keys[i]].bytes > t[keys[j]].bytes
+        }
+        return keys[i] < keys[j]
+    })
+
+    w := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+    fmt.Fprintf(w, "%s\tfiles\tbytes\n", heading)
+    for _, k := range keys {
+        fmt.Fprintf(w, "%s\t%d\t%d\n", k, t[k].files, t[k].bytes)
+    }
+    w.Flush()
+}
+
+// The directory containing path; for an archive entry, the directory
+// containing the archive.
+func directory(path string) string {
+    if i := strings.Index(path, archiveSep); i >= 0 {
+        path = path[:i]
+    }
+    return filepath.Dir(path)
+}
+
+func extension(path string) string {
+    ext := strings.ToLower(filepath.Ext(path))
+    if ext == "" {
+        return "(none)"
+    }
+    return ext
+}
+
+// Bytes that would be freed by removing all but one file of g.
+func (g group) reclaimable() int64 {
+    return int64(len(g) - 1) * g[0].size
+}
+
+// Keep only the n groups with the most reclaimable bytes, or with the most
+// members if by is "count", largest first. Ties keep their order.
+func top(groups []group, n int, by string) []group {
+    sort.SliceStable(groups, func(i, j int) bool {
+        if by == "count" {
+            return len(groups[i]) > len(groups[j])
+        }
+        return groups[i].reclaimable() > groups[j].reclaimable()
+    })
+    if n < len(groups) {
+        fmt.Fprintf(os.Stderr, "%s: showing the top %d groups; %d omitted\n",
+                    os.Args[0], n, len(groups) - n)
+        groups = groups[:n]
+    }
+    return groups
+}
+
+// Print on stderr an extrapolation of the redundancy in the whole tree
+// from the redundancy found in a sample of rate.
+//
+// A pair of duplicates is only seen when both files are in the sample,
+// which happens with probability rate², so that's what we scale by.
+// This is exact in expectation for pairs; it overestimates for files that
+// have many copies.
+func printEstimate(groups []group, rate float64) {
+    var files, bytes float64
+    for _, g := range groups {
+        files += float64(len(g) - 1)
+        bytes += float64(g.reclaimable())
+    }
+    scale := 1 / (rate * rate)
+    fmt.Fprintf(os.Stderr, "%s: estimate from a %g%% sample: "+
+                "about %.0f redundant files taking %.0f bytes\n",
+                os.Args[0], 100 * rate, files * scale, bytes * scale)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+    "bytes"
+    "path/filepath"
+    "strings"
+)
+
+// With NormalizeText, text files up to this size are hashed in
+// normalized form. Larger files are hashed as they are.
+const textLimit = 1 << 20
+
+var textExts = map[string]bool{
+    ".c": true, ".cfg": true, ".conf": true, ".cpp": true, ".css": true,
+    ".csv": true, ".go": true, ".h": true, ".htm": true, ".html": true,
+    ".ini": true, ".java": true, ".js": true, ".json": true, ".md": true,
+    ".py": true, ".rst": true, ".sh": true, ".tex": true, ".toml": true,
+    ".txt": true, ".xml": true, ".yaml": true, ".yml": true,
+}
+
+// Source code, for IgnoreEOL.
+var sourceExts = map[string]bool{
+    ".bat": true, ".c": true, ".cc": true, ".cpp": true, ".cs": true,
+    ".css": true, ".cxx": true, ".go": true, ".h": true, ".hpp": true,
+    ".htm": true, ".html": true, ".java": true, ".js": true, ".json": true,
+    ".kt": true, ".lua": true, ".m": true, ".md": true, ".php": true,
+    ".pl": true, ".ps1": true, ".py": true, ".rb": true, ".rs": true,
+    ".scala": true, ".sh": true, ".sql": true, ".swift": true, ".tex": true,
+    ".ts": true, ".txt": true, ".xml": true, ".yaml": true, ".yml": true,
+}
+
+// Reports whether the file at path, of the given size, is hashed in
+// normalized form.
+func (o *Options) isNormalized(path string, size int64) bool {
+    return o.NormalizeText && size <= textLimit &&
+           textExts[strings.ToLower(filepath.Ext(path))]
+}
+
+// Reports whether line endings in the file at path, of the given size,
+// are normalized before hashing, unless it turns out to be binary.
+func (o *Options) ignoresEOL(path string, size int64) bool {
+    return o.IgnoreEOL && size <= o.EOLLimit &&
+           sourceExts[strings.ToLower(filepath.Ext(path))]
+}
+
+// Returns the function that normalizes the contents of the file at path,
+// of the given size, before hashing, or nil if it's hashed as it is.
+func (o *Options) normalizer(path string, size int64) func([]byte) []byte {
+    switch {
+    case o.isNormalized(path, size):
+        return normalize
+    case o.ignoresEOL(path, size):
+        return normalizeEOL
+    }
+    return nil
+}
+
+// Turn CRLF line endings into LF, unless text looks binary: like Git,
+// take a NUL byte in the first 8000 to mean it is.
+func normalizeEOL(text []byte) []byte {
+    if bytes.IndexByte(text[:min(len(text), 8000)], 0) >= 0 {
+        return text
+    }
+    return bytes.Replace(text, []byte("\r\n"), []byte("\n"), -1)
+}
+
+// Normalize text by lowercasing it and turning CRLF line endings into LF.
+func normalize(text []byte) []byte {
+    return bytes.ToLower(bytes.Replace(text, []byte("\r\n"), []byte("\n"), -1))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// Scan the trees at roots and print the groups found, in format and
+// style, then keep watching the trees and print groups as they form.
+// Each group is passed through shape first, as the groups of a normal
+// scan are, and only printed if anything is left of it. Only returns,
+// with the exit code, when watching fails.
+func watchMode(roots []string, produce func(paths chan<- pathInfo) int,
+               o *Options, shape func([]group) []group, format string,
+               style textStyle) int {
+    byhash, _ := hashAll(produce, o, true)
+    prog.stop()
+
+    emit := func(g group) error {
+        // A copy, since shape may reorder the group and change its hash.
+        groups := shape([]group{append(group(nil), g...)})
+        if len(groups) == 0 {
+            return nil
+        }
+        if format == "jsonl" {
+            return writeJSONL(os.Stdout, groups, nil, nil, false)
+        }
+        return writeText(os.Stdout, groups, style)
+    }
+    for _, g := range duplicates(byhash, o) {
+        if err := emit(g); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+            return 1
+        }
+    }
+
+    err := watch(roots, byhash, o, emit)
+    fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+    return 1
+}
+
+// A change to a watched tree: the file or directory at path was created,
+// written, moved or removed. With overflow, changes may have been lost.
+type fsEvent struct {
+    path     string
+    dir      bool
+    removed  bool
+    overflow bool
+}
+
+// The files of a watched tree by hash, and the other way around.
+type index struct {
+    byhash map[string]group
+    bypath map[string]string
+    o      *Options
+}
+
+// Watch the trees at roots for changes after a scan that found byhash,
+// keeping byhash up to date, and emit each group that forms or gets a new
+// member. Runs until an error occurs.
+func watch(roots []string, byhash map[string]group, o *Options,
+           emit func(group) error) error {
+    w, err := newDirWatcher()
+    if err != nil {
+        return err
+    }
+    ix := &index{byhash: byhash, bypath: make(map[string]string), o: o}
+    for h, g := range byhash {
+        for _, p := range g {
+            if !p.inArchive() {
+                ix.bypath[p.path] = h
+            }
+        }
+    }
+    for _, root := range roots {
+        ix.addTree(w, root, nil)
+    }
+
+    for {
+        events, err := w.next()
+        if err != nil {
+            return err
+        }
+        var changed []string    // hashes of groups that grew
+        for _, ev := range events {
+            switch {
+            case ev.overflow:
+                errors <- fmt.Errorf("-watch: too many changes at once;" +
+                                     " some were missed")
+            case ev.removed && ev.dir:
+                ix.removeTree(ev.path)
+            case ev.removed:
+                ix.remove(ev.path)
+            case ev.dir:
+                if !ix.o.prunedDir(ev.path) {
+                    ix.addTree(w, ev.path, &changed)
+                }
+            default:
+                if h := ix.update(ev.path); h != "" {
+                    changed = append(changed, h)
+                }
+            }
+        }
+        seen := make(map[string]bool)
+        for _, h := range changed {
+            if g := ix.byhash[h]; len(g) > 1 && !seen[h] {
+                seen[h] = true
+                sorted := append(group(nil), g...)
+                sort.Slice(sorted, func(i, j int) bool {
+                    return sorted[i].path < sorted[j].path
+                })
+                if err := emit(sorted); err != nil {
+                    return err
+                }
+            }
+        }
+    }
+}
+
+// Watch the directory tree at root. If changed isn't nil, the files in it
+// are (re)hashed, and the hashes of groups they join added to changed.
+func (ix *index) addTree(w *dirWatcher, root string, changed *[]string) {
+    filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+        switch {
+        case err != nil:
+            errors <- err
+        case d.IsDir() && (ix.o.own(path) || ix.o.SkipMounts[abs(path)] ||
+                           path != root && ix.o.prunedDir(path)):
+            return filepath.SkipDir
+        case d.IsDir():
+            if err := w.add(path); err != nil {
+                errors <- err
+            }
+        case changed != nil && d.Type().IsRegular():
+            if h := ix.update(path); h != "" {
+                *changed = append(*changed, h)
+            }
+        }
+        return nil
+    })
+}
+
+func abs(path string) string {
+    if a, err := filepath.Abs(path); err == nil {
+        return a
+    }
+    return path
+}
+
+// Hash the file at path again and move it to the right group. Returns its
+// hash, or "" if it isn't checked.
+func (ix *index) update(path string) string {
+    ix.remove(path)
+    info, err := os.Lstat(path)
+    if err != nil {
+        return ""       // already gone again
+    }
+    if !info.Mode().IsRegular() || !ix.o.wanted(path, info) {
+        return ""
+    }
+    h, size, err := hashFile(path, info.Size(), ix.o)
+    if err != nil {
+        errors <- err
+        return ""
+    }
+    p := pathInfo{path: path, size: size, info: info, hash: h}
+    ix.byhash[h] = append(ix.byhash[h], p)
+    ix.bypath[path] = h
+    return h
+}
+
+// Forget the file at path.
+func (ix *index) remove(path string) {
+    h, ok := ix.bypath[path]
+    if !ok {
+        return
+    }
+    delete(ix.bypath, path)
+    g := ix.byhash[h][:0]
+    for _, p := range ix.byhash[h] {
+        if p.path != path {
+            g = append(g, p)
+        }
+    }
+    if len(g) == 0 {
+        delete(ix.byhash, h)
+    } else {
+        ix.byhash[h] = g
+    }
+}
+
+// Forget all files under the directory dir.
+func (ix *index) removeTree(dir string) {
+    prefix := dir + string(os.PathSeparator)
+    for path := range ix.bypath {
+        if strings.HasPrefix(path, prefix) {
+            ix.remove(path)
+        }
+    }
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+// Warn on stderr about the files of groups whose extended attributes
+// differ from those of the first file of their group outside archives,
+// for -compare-xattr. Does nothing where extended attributes aren't
+// supported.
+func compareXattrs(groups []group) {
+    if !haveXattr {
+        return
+    }
+    for _, g := range groups {
+        var first string
+        var attrs map[string]string
+        for _, p := range g {
+            if p.inArchive() {
+                continue
+            }
+            a, err := xattrs(p.path)
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+                continue
+            }
+            if first == "" {
+                first, attrs = p.path, a
+            } else if !sameXattrs(attrs, a) {
+                fmt.Fprintf(os.Stderr, "%s: WARNING: %s has the same"+
+                            " contents as %s, but different extended"+
+                            " attributes\n", os.Args[0], p.path, first)
+            }
+        }
+    }
+}
+
+func sameXattrs(a, b map[string]string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for k, v := range a {
+        if w, ok := b[k]; !ok || v != w {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+    "bytes"
+    "os"
+    "syscall"
+)
+
+const haveXattr = true
+
+// Returns the extended attributes of the file at path, by name.
+func xattrs(path string) (map[string]string, error) {
+    names, err := getXattr(func(buf []byte) (int, error) {
+        return syscall.Listxattr(path, buf)
+    })
+    if err != nil {
+        return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+    }
+
+    attrs := make(map[string]string)
+    for _, name := range bytes.Split(names, []byte{0}) {
+        if len(name) == 0 {
+            continue
+        }
+        value, err := getXattr(func(buf []byte) (int, error) {
+            return syscall.Getxattr(path, string(name), buf)
+        })
+        if err != nil {
+            return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+        }
+        attrs[string(name)] = string(value)
+    }
+    return attrs, nil
+}
+
+// Call get, which works like listxattr(2) or getxattr(2), to find the
+// size of the result, then again to fetch it, retrying if it grew in
+// between.
+func getXattr(get func([]byte) (int, error)) ([]byte, error) {
+    for {
+        n, err := get(nil)
+        if err != nil {
+            return nil, err
+        }
+        if n == 0 {
+            return nil, nil
+        }
+        buf := make([]byte, n)
+        n, err = get(buf)
+        if err == syscall.ERANGE {
+            continue
+        } else if err != nil {
+            return nil, err
+        }
+        return buf[:n], nil
+    }
+}
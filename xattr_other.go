@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+const haveXattr = false
+
+func xattrs(path string) (map[string]string, error) {
+    return nil, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "os"
+)
+
+// A failing drive or controller can return zeros instead of a file's
+// contents without reporting an error. Distinct files then look like
+// duplicates, and removing all but one of them would be disastrous.
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+    clear(p)
+    return len(p), nil
+}
+
+// Remove the groups of non-empty files consisting entirely of zero bytes
+// from groups, warning about each on stderr, and return the rest. The
+// first skip bytes of each file weren't hashed (see -skip-header-bytes),
+// so they don't count.
+func dropZeros(groups []group, skip int64) []group {
+    digests := make(map[int64]string)   // hashes of all-zero files by size
+
+    return filterGroups(groups, func(g group) bool {
+        size := g[0].size
+        if size <= skip {
+            return true
+        }
+        zero, ok := digests[size]
+        if !ok {
+            n := size - skip
+            zero, _, _ = hashReader(io.LimitReader(zeroReader{}, n), n)
+            digests[size] = zero
+        }
+        if g[0].hash != zero {
+            return true
+        }
+        fmt.Fprintf(os.Stderr, "%s: WARNING: %s and %d other files of"+
+                    " %d bytes read as all zeros, possibly because of a"+
+                    " failing drive; not reported as duplicates\n",
+                    os.Args[0], g[0].path, len(g) - 1, size)
+        return false
+    })
+}